@@ -0,0 +1,128 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Alert-matrix messages from docs/VECAN_2.0.16_DI.dbc: DIR_alertMatrix1-4 (rear
+// inverter), DIF_alertMatrix1-4 (front inverter) and the multiplexed BMS_alertMatrix.
+// Every alert is a one-bit signal named <prefix>_a<NNN>_<name>.
+var (
+	alertMessagePattern = regexp.MustCompile(`^(DIR|DIF|BMS)_alertMatrix`)
+	alertSignalPattern  = regexp.MustCompile(`^(DIR|DIF|BMS)_(a\d{3})_(.+)$`)
+
+	// The inverter alerts run a phase or sensor letter into the next word, e.g.
+	// hwPhaseAgateDrive, phaseBrms, busVsensor, and a supply voltage into "hw",
+	// e.g. hw12vSupplyUV.
+	alertLetterPattern = regexp.MustCompile(`([a-z])([ABCV])(gate|peak|rms|current|sensor)`)
+	alertSupplyPattern = regexp.MustCompile(`^hw(\d)`)
+)
+
+var alertSources = map[string]string{
+	"DIR": "rear",
+	"DIF": "front",
+	"BMS": "bms",
+}
+
+// decodeAlertFrame updates the fault catalogue from a DBC-decoded alert-matrix frame.
+// Frames that are not alert matrices are ignored; now is the frame receive time.
+func (st *telemetryState) decodeAlertFrame(def *dbcMessage, signals []decodedSignal, now string) {
+	if st.AlertData == nil || def == nil || !alertMessagePattern.MatchString(def.Name) {
+		return
+	}
+
+	for _, sig := range signals {
+		parts := alertSignalPattern.FindStringSubmatch(sig.Name)
+		if parts == nil {
+			continue // multiplexer index
+		}
+		active := sig.Raw != 0
+
+		idx := st.findAlert(sig.Name)
+		if idx < 0 {
+			if !active {
+				continue // only list alerts that have been set at least once
+			}
+			idx = st.insertAlert(AlertEntry{
+				Name:        sig.Name,
+				Code:        parts[2],
+				Source:      alertSources[parts[1]],
+				Message:     def.Name,
+				Description: describeAlert(parts[3]),
+			})
+		}
+
+		alert := &st.AlertData.Alerts[idx]
+		switch {
+		case active && !alert.Active:
+			alert.Active = true
+			alert.SetCount++
+			alert.SetAt = now
+			alert.ClearedAt = ""
+		case !active && alert.Active:
+			alert.Active = false
+			alert.ClearedAt = now
+		}
+	}
+
+	st.AlertData.ActiveCount = 0
+	for _, alert := range st.AlertData.Alerts {
+		if alert.Active {
+			st.AlertData.ActiveCount++
+		}
+	}
+	st.AlertData.MessageCount[def.Name]++
+	st.AlertData.LastUpdate = now
+
+	st.touch(docAlerts)
+}
+
+// alertLess orders the catalogue by source and alert code.
+func alertLess(a, b *AlertEntry) bool {
+	if a.Source != b.Source {
+		return a.Source < b.Source
+	}
+	if a.Code != b.Code {
+		return a.Code < b.Code
+	}
+	return a.Name < b.Name
+}
+
+func (st *telemetryState) findAlert(name string) int {
+	for i := range st.AlertData.Alerts {
+		if st.AlertData.Alerts[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// insertAlert adds an alert in catalogue order and returns its index.
+func (st *telemetryState) insertAlert(entry AlertEntry) int {
+	alerts := st.AlertData.Alerts
+	idx := sort.Search(len(alerts), func(i int) bool { return !alertLess(&alerts[i], &entry) })
+	alerts = append(alerts, AlertEntry{})
+	copy(alerts[idx+1:], alerts[idx:])
+	alerts[idx] = entry
+	st.AlertData.Alerts = alerts
+	return idx
+}
+
+// describeAlert turns the name part of an alert signal into words, e.g.
+// "hwPhaseAgateDrive" -> "Hw Phase A Gate Drive", "SW_Brick_OV" -> "SW Brick OV".
+func describeAlert(name string) string {
+	name = alertLetterPattern.ReplaceAllStringFunc(name, func(m string) string {
+		return m[:1] + "_" + m[1:2] + "_" + strings.ToUpper(m[2:3]) + m[3:]
+	})
+	name = alertSupplyPattern.ReplaceAllString(name, "hw_$1")
+	words := splitWords(name)
+	if len(words) > 0 {
+		first := []rune(words[0])
+		first[0] = unicode.ToUpper(first[0])
+		words[0] = string(first)
+	}
+	return strings.Join(words, " ")
+}
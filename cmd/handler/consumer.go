@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/canframe"
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/natsconf"
+	"github.com/nats-io/nats.go"
+	"github.com/spf13/viper"
+)
+
+// consumerConfig holds the handler.consumer settings.
+type consumerConfig struct {
+	Durable       string
+	Deliver       nats.DeliverPolicy // where a new consumer starts; an existing one resumes
+	AckWait       time.Duration
+	MaxAckPending int
+	Batch         int
+	FilterIDs     bool // only receive the IDs the handler decodes
+}
+
+// loadConsumerConfig reads handler.consumer from the viper configuration.
+func loadConsumerConfig() (consumerConfig, error) {
+	viper.SetDefault("handler.consumer.durable", "handler")
+	viper.SetDefault("handler.consumer.deliver", "new")
+	viper.SetDefault("handler.consumer.ack_wait", 30*time.Second)
+	viper.SetDefault("handler.consumer.max_ack_pending", 4096)
+	viper.SetDefault("handler.consumer.batch", 256)
+	viper.SetDefault("handler.consumer.filter_ids", true)
+
+	cfg := consumerConfig{
+		Durable:       viper.GetString("handler.consumer.durable"),
+		AckWait:       viper.GetDuration("handler.consumer.ack_wait"),
+		MaxAckPending: viper.GetInt("handler.consumer.max_ack_pending"),
+		Batch:         viper.GetInt("handler.consumer.batch"),
+		FilterIDs:     viper.GetBool("handler.consumer.filter_ids"),
+	}
+	switch deliver := viper.GetString("handler.consumer.deliver"); deliver {
+	case "new":
+		cfg.Deliver = nats.DeliverNewPolicy
+	case "all":
+		cfg.Deliver = nats.DeliverAllPolicy
+	default:
+		return cfg, fmt.Errorf("handler.consumer.deliver must be new or all, got %q", deliver)
+	}
+	if cfg.Durable == "" {
+		return cfg, fmt.Errorf("handler.consumer.durable is required")
+	}
+	if cfg.AckWait <= 0 || cfg.Batch <= 0 || cfg.MaxAckPending < cfg.Batch {
+		return cfg, fmt.Errorf("handler.consumer: ack_wait and batch must be positive and max_ack_pending at least batch")
+	}
+	return cfg, nil
+}
+
+// decodedSubjects returns the subjects of the frames the handler decodes:
+// can.raw.*.<id> for every message of the dbc.files fallback,
+// can.raw.<channel>.<id> for the other messages of a channel's DBC files, plus
+// can.raw and can.raw.<channel> where readers in the older layouts publish
+// everything. Filter subjects may not overlap, so a channel's ID already
+// covered by the wildcard is not listed again.
+func decodedSubjects(r *dbcRouter) []string {
+	seen := map[string]bool{"can.raw": true, "can.raw.*": true}
+	for _, msg := range r.fallback.messages {
+		seen["can.raw.*."+canframe.FormatID(msg.ID, msg.Extended)] = true
+	}
+	for channel, db := range r.channels {
+		for key, msg := range db.messages {
+			if r.fallback.messages[key] != nil {
+				continue
+			}
+			seen["can.raw."+channel+"."+canframe.FormatID(msg.ID, msg.Extended)] = true
+		}
+	}
+	subjects := make([]string, 0, len(seen))
+	for subject := range seen {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+	return subjects
+}
+
+// frameConsumer pulls raw frames from the reader's stream through a durable
+// consumer, so frames published while the handler restarts are processed when
+// it comes back, from the last acknowledged one on. With filter set the
+// consumer only delivers those subjects (needs nats-server 2.10).
+type frameConsumer struct {
+	js     nats.JetStreamContext
+	stream *nats.StreamConfig
+	cfg    consumerConfig
+	filter []string
+}
+
+// subscribe makes sure the stream and the durable consumer exist and binds to
+// the consumer. It keeps retrying while NATS or JetStream is unavailable, and
+// returns nil when ctx is done first.
+func (c *frameConsumer) subscribe(ctx context.Context) *nats.Subscription {
+	for attempt := 0; ; attempt++ {
+		sub, err := c.trySubscribe()
+		if err == nil {
+			return sub
+		}
+		if attempt == 0 {
+			log.Printf("Waiting for JetStream consumer %s on stream %s: %v", c.cfg.Durable, c.stream.Name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+func (c *frameConsumer) trySubscribe() (*nats.Subscription, error) {
+	if err := natsconf.EnsureStream(c.js, c.stream); err != nil {
+		return nil, err
+	}
+	info, err := c.js.ConsumerInfo(c.stream.Name, c.cfg.Durable)
+	switch {
+	case errors.Is(err, nats.ErrConsumerNotFound):
+		_, err = c.js.AddConsumer(c.stream.Name, &nats.ConsumerConfig{
+			Durable:        c.cfg.Durable,
+			DeliverPolicy:  c.cfg.Deliver,
+			AckPolicy:      nats.AckAllPolicy,
+			AckWait:        c.cfg.AckWait,
+			MaxAckPending:  c.cfg.MaxAckPending,
+			FilterSubjects: c.filter,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("creating consumer: %w", err)
+		}
+		log.Printf("Created JetStream consumer %s on stream %s", c.cfg.Durable, c.stream.Name)
+	case err != nil:
+		return nil, err
+	default:
+		// The delivery position is kept; the limits and the filter follow the
+		// config and the loaded DBC files
+		cfg := info.Config
+		cfg.AckWait = c.cfg.AckWait
+		cfg.MaxAckPending = c.cfg.MaxAckPending
+		cfg.FilterSubject = ""
+		cfg.FilterSubjects = c.filter
+		if _, err := c.js.UpdateConsumer(c.stream.Name, &cfg); err != nil {
+			return nil, fmt.Errorf("updating consumer: %w", err)
+		}
+		log.Printf("Resuming JetStream consumer %s on stream %s, %d frames pending", c.cfg.Durable, c.stream.Name, info.NumPending)
+	}
+	return c.js.PullSubscribe("", c.cfg.Durable, nats.Bind(c.stream.Name, c.cfg.Durable))
+}
+
+// run hands every frame to handle until ctx is done. The consumer acknowledges
+// all frames up to the last one of a batch once the batch is handled, so a
+// batch being handled at shutdown is finished and acknowledged first.
+func (c *frameConsumer) run(ctx context.Context, handle func(*nats.Msg)) {
+	sub := c.subscribe(ctx)
+	if sub == nil {
+		return
+	}
+	for ctx.Err() == nil {
+		msgs, err := sub.Fetch(c.cfg.Batch, nats.MaxWait(time.Second))
+		if err != nil {
+			if !errors.Is(err, nats.ErrTimeout) && ctx.Err() == nil {
+				log.Printf("Fetching frames failed: %v", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+		for _, m := range msgs {
+			handle(m)
+		}
+		if len(msgs) > 0 {
+			if err := msgs[len(msgs)-1].Ack(); err != nil {
+				log.Printf("Acknowledging frames failed: %v", err)
+			}
+		}
+	}
+}
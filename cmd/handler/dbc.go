@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.einride.tech/can/pkg/dbc"
+)
+
+// dbcSignal is a signal definition compiled from a DBC SG_ line.
+type dbcSignal struct {
+	Name      string
+	StartBit  uint
+	Length    uint
+	BigEndian bool // Motorola (@0) byte order
+	Signed    bool
+	ValueType dbc.SignalValueType // integer, float32 or float64 (SIG_VALTYPE_)
+	Factor    float64
+	Offset    float64
+	Unit      string
+	Values    map[int64]string // VAL_ descriptions keyed by raw value
+
+	IsMultiplexer bool   // signal is the multiplexer switch (M)
+	IsMultiplexed bool   // signal is only present for one switch value (mN)
+	MuxValue      uint64 // switch value the signal belongs to when multiplexed
+}
+
+// dbcMessage is a message definition compiled from a DBC BO_ block.
+type dbcMessage struct {
+	ID          uint32
+	Extended    bool
+	Name        string
+	Size        int
+	Source      string        // base name of the DBC file that defined the message
+	Sender      string        // transmitting node, empty for Vector__XXX
+	CycleTime   time.Duration // GenMsgCycleTime, zero when not specified
+	Signals     []*dbcSignal
+	Multiplexer *dbcSignal
+}
+
+// decodedSignal is the physical value of one signal in a received frame.
+type decodedSignal struct {
+	Name        string
+	Raw         int64
+	Value       float64
+	Unit        string
+	Description string
+}
+
+// messageKey identifies a message by CAN ID and frame format; a standard and an
+// extended frame with the same numeric ID are different messages.
+type messageKey struct {
+	ID       uint32
+	Extended bool
+}
+
+// dbcDatabase holds the messages of every loaded DBC file.
+type dbcDatabase struct {
+	messages map[messageKey]*dbcMessage
+	names    map[string]*dbcMessage
+}
+
+// loadDBCFiles parses the given DBC files into one database. Two files defining
+// the same CAN ID or message name is an error; bind them to different channels
+// instead.
+func loadDBCFiles(paths []string) (*dbcDatabase, error) {
+	db := &dbcDatabase{
+		messages: make(map[messageKey]*dbcMessage),
+		names:    make(map[string]*dbcMessage),
+	}
+	for _, path := range paths {
+		if err := db.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+func (db *dbcDatabase) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read DBC file %s: %w", path, err)
+	}
+
+	parser := dbc.NewParser(path, data)
+	if err := parser.Parse(); err != nil {
+		return fmt.Errorf("failed to parse DBC file %s: %w", path, err)
+	}
+
+	source := filepath.Base(path)
+	local := make(map[dbc.MessageID]*dbcMessage)
+	var order []dbc.MessageID
+
+	// First pass: messages and signals.
+	for _, def := range parser.Defs() {
+		msgDef, ok := def.(*dbc.MessageDef)
+		if !ok || dbc.IsIndependentSignalsMessage(msgDef) {
+			continue
+		}
+		msg := &dbcMessage{
+			ID:       msgDef.MessageID.ToCAN(),
+			Extended: msgDef.MessageID.IsExtended(),
+			Name:     string(msgDef.Name),
+			Size:     int(msgDef.Size),
+			Source:   source,
+		}
+		if msgDef.Transmitter != dbc.NodePlaceholder {
+			msg.Sender = string(msgDef.Transmitter)
+		}
+		for i := range msgDef.Signals {
+			sigDef := &msgDef.Signals[i]
+			sig := &dbcSignal{
+				Name:          string(sigDef.Name),
+				StartBit:      uint(sigDef.StartBit),
+				Length:        uint(sigDef.Size),
+				BigEndian:     sigDef.IsBigEndian,
+				Signed:        sigDef.IsSigned,
+				Factor:        sigDef.Factor,
+				Offset:        sigDef.Offset,
+				Unit:          sigDef.Unit,
+				IsMultiplexer: sigDef.IsMultiplexerSwitch,
+				IsMultiplexed: sigDef.IsMultiplexed,
+				MuxValue:      sigDef.MultiplexerSwitch,
+			}
+			if sig.IsMultiplexer {
+				msg.Multiplexer = sig
+			}
+			msg.Signals = append(msg.Signals, sig)
+		}
+		local[msgDef.MessageID] = msg
+		order = append(order, msgDef.MessageID)
+	}
+
+	// Second pass: value tables, signal value types and cycle times refer back to messages.
+	for _, def := range parser.Defs() {
+		switch d := def.(type) {
+		case *dbc.ValueDescriptionsDef:
+			if d.ObjectType != dbc.ObjectTypeSignal {
+				continue
+			}
+			sig := local[d.MessageID].signal(string(d.SignalName))
+			if sig == nil {
+				continue
+			}
+			sig.Values = make(map[int64]string, len(d.ValueDescriptions))
+			for _, vd := range d.ValueDescriptions {
+				sig.Values[int64(vd.Value)] = vd.Description
+			}
+		case *dbc.SignalValueTypeDef:
+			if sig := local[d.MessageID].signal(string(d.SignalName)); sig != nil {
+				sig.ValueType = d.SignalValueType
+			}
+		case *dbc.AttributeValueForObjectDef:
+			msg := local[d.MessageID]
+			if d.ObjectType != dbc.ObjectTypeMessage || d.AttributeName != "GenMsgCycleTime" || msg == nil {
+				continue
+			}
+			ms := float64(d.IntValue)
+			if ms == 0 {
+				ms = d.FloatValue
+			}
+			msg.CycleTime = time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+
+	for _, id := range order {
+		msg := local[id]
+		key := messageKey{ID: msg.ID, Extended: msg.Extended}
+		if existing, ok := db.messages[key]; ok {
+			return fmt.Errorf("DBC %s: %s (0x%X) is already defined as %s by %s", source, msg.Name, msg.ID, existing.Name, existing.Source)
+		}
+		if existing, ok := db.names[msg.Name]; ok {
+			return fmt.Errorf("DBC %s: %s (0x%X) is already defined as 0x%X by %s", source, msg.Name, msg.ID, existing.ID, existing.Source)
+		}
+		db.messages[key] = msg
+		db.names[msg.Name] = msg
+	}
+	log.Printf("Loaded %d messages from DBC %s", len(order), path)
+	return nil
+}
+
+// lookup returns the message definition for a CAN ID, or nil if no DBC defines it.
+// A standard and an extended frame with the same numeric ID are different messages.
+func (db *dbcDatabase) lookup(id uint32, extended bool) *dbcMessage {
+	if db == nil {
+		return nil
+	}
+	return db.messages[messageKey{ID: id, Extended: extended}]
+}
+
+// dbcChannelConfig binds DBC files to one reader channel (dbc.channels).
+type dbcChannelConfig struct {
+	Name  string   `mapstructure:"name"`
+	Files []string `mapstructure:"files"`
+}
+
+// dbcRouter selects the DBC database by the channel a frame was read on, so
+// the same CAN ID can mean different messages on different buses.
+type dbcRouter struct {
+	channels map[string]*dbcDatabase
+	fallback *dbcDatabase // dbc.files: unlisted channels and frames without one
+}
+
+// loadDBCRouter loads dbc.channels and the dbc.files fallback.
+func loadDBCRouter() (*dbcRouter, error) {
+	var channels []dbcChannelConfig
+	if err := viper.UnmarshalKey("dbc.channels", &channels); err != nil {
+		return nil, fmt.Errorf("dbc.channels: %w", err)
+	}
+
+	r := &dbcRouter{channels: make(map[string]*dbcDatabase, len(channels))}
+	for i, ch := range channels {
+		if ch.Name == "" {
+			return nil, fmt.Errorf("dbc.channels[%d]: name is required", i)
+		}
+		if r.channels[ch.Name] != nil {
+			return nil, fmt.Errorf("dbc.channels: duplicate channel name %q", ch.Name)
+		}
+		db, err := loadDBCFiles(ch.Files)
+		if err != nil {
+			return nil, fmt.Errorf("dbc.channels[%d] (%s): %w", i, ch.Name, err)
+		}
+		log.Printf("Channel %s: DBC decoding enabled for %d messages from %v", ch.Name, len(db.messages), ch.Files)
+		r.channels[ch.Name] = db
+	}
+
+	files := viper.GetStringSlice("dbc.files")
+	db, err := loadDBCFiles(files)
+	if err != nil {
+		return nil, fmt.Errorf("dbc.files: %w", err)
+	}
+	log.Printf("Other channels: DBC decoding enabled for %d messages from %v", len(db.messages), files)
+	r.fallback = db
+	return r, nil
+}
+
+// database returns the DBC database of a channel.
+func (r *dbcRouter) database(channel string) *dbcDatabase {
+	if db, ok := r.channels[channel]; ok {
+		return db
+	}
+	return r.fallback
+}
+
+// lookup returns the message definition for a frame read on channel, or nil if
+// the channel's DBC files do not define it.
+func (r *dbcRouter) lookup(channel string, id uint32, extended bool) *dbcMessage {
+	return r.database(channel).lookup(id, extended)
+}
+
+func (m *dbcMessage) signal(name string) *dbcSignal {
+	if m == nil {
+		return nil
+	}
+	for _, sig := range m.Signals {
+		if sig.Name == name {
+			return sig
+		}
+	}
+	return nil
+}
+
+// decode extracts every signal present in the payload. Multiplexed signals are
+// only returned when the multiplexer switch selects them, and signals that do
+// not fit in a short frame are skipped.
+func (m *dbcMessage) decode(payload []byte) []decodedSignal {
+	var (
+		muxValue uint64
+		haveMux  bool
+	)
+	if m.Multiplexer != nil {
+		raw, ok := m.Multiplexer.extract(payload)
+		if !ok {
+			return nil
+		}
+		muxValue, haveMux = raw, true
+	}
+
+	signals := make([]decodedSignal, 0, len(m.Signals))
+	for _, sig := range m.Signals {
+		if sig.IsMultiplexed && (!haveMux || sig.MuxValue != muxValue) {
+			continue
+		}
+		bits, ok := sig.extract(payload)
+		if !ok {
+			continue
+		}
+		signals = append(signals, sig.physical(bits))
+	}
+	return signals
+}
+
+// extract returns the raw, unscaled bits of the signal.
+func (s *dbcSignal) extract(payload []byte) (uint64, bool) {
+	if s.Length == 0 || s.Length > 64 {
+		return 0, false
+	}
+
+	var raw uint64
+	if s.BigEndian {
+		// Motorola: the start bit is the MSB, walking the DBC sawtooth bit numbering.
+		pos := s.StartBit
+		for i := uint(0); i < s.Length; i++ {
+			bit, ok := bitAt(payload, pos)
+			if !ok {
+				return 0, false
+			}
+			raw = raw<<1 | bit
+			if pos%8 == 0 {
+				pos += 15
+			} else {
+				pos--
+			}
+		}
+		return raw, true
+	}
+
+	// Intel: the start bit is the LSB and the signal grows towards higher bits.
+	for i := uint(0); i < s.Length; i++ {
+		bit, ok := bitAt(payload, s.StartBit+i)
+		if !ok {
+			return 0, false
+		}
+		raw |= bit << i
+	}
+	return raw, true
+}
+
+// physical applies value type, sign, factor, offset and value descriptions to raw bits.
+func (s *dbcSignal) physical(bits uint64) decodedSignal {
+	out := decodedSignal{Name: s.Name, Unit: s.Unit}
+
+	var value float64
+	switch {
+	case s.ValueType == dbc.SignalValueTypeFloat32 && s.Length == 32:
+		value = float64(math.Float32frombits(uint32(bits)))
+		out.Raw = int64(bits)
+	case s.ValueType == dbc.SignalValueTypeFloat64 && s.Length == 64:
+		value = math.Float64frombits(bits)
+		out.Raw = int64(bits)
+	case s.Signed:
+		out.Raw = signExtend(bits, s.Length)
+		value = float64(out.Raw)
+	default:
+		out.Raw = int64(bits)
+		value = float64(bits)
+	}
+
+	out.Value = value*s.Factor + s.Offset
+	if desc, ok := s.Values[out.Raw]; ok {
+		out.Description = desc
+	}
+	return out
+}
+
+func bitAt(payload []byte, pos uint) (uint64, bool) {
+	if int(pos/8) >= len(payload) {
+		return 0, false
+	}
+	return uint64(payload[pos/8]>>(pos%8)) & 1, true
+}
+
+func signExtend(bits uint64, length uint) int64 {
+	if length >= 64 {
+		return int64(bits)
+	}
+	shift := 64 - length
+	return int64(bits<<shift) >> shift
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/hex"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testDBC = `VERSION ""
+
+NS_ :
+
+BS_:
+
+BU_: ECU
+
+BO_ 256 IntelMsg: 8 ECU
+ SG_ Speed : 0|16@1+ (0.1,0) [0|6553.5] "km/h" Vector__XXX
+ SG_ Current : 16|16@1- (0.1,-10) [-3286.8|3266.7] "A" Vector__XXX
+ SG_ Flag : 35|1@1+ (1,0) [0|1] "" Vector__XXX
+ SG_ Odd : 36|12@1+ (1,0) [0|4095] "" Vector__XXX
+
+BO_ 257 MotorolaMsg: 8 ECU
+ SG_ Word : 7|16@0+ (1,0) [0|65535] "" Vector__XXX
+ SG_ Signed : 23|16@0- (0.5,0) [-16384|16383.5] "" Vector__XXX
+ SG_ High : 39|4@0+ (1,0) [0|15] "" Vector__XXX
+ SG_ Cross : 34|12@0+ (1,0) [0|4095] "" Vector__XXX
+
+BO_ 258 MuxMsg: 8 ECU
+ SG_ Page M : 0|8@1+ (1,0) [0|255] "" Vector__XXX
+ SG_ Common : 8|8@1+ (1,0) [0|255] "" Vector__XXX
+ SG_ PageA m0 : 16|16@1+ (1,0) [0|65535] "" Vector__XXX
+ SG_ PageB m1 : 16|16@1- (2,0) [-65536|65534] "" Vector__XXX
+
+BO_ 2147483904 ExtendedMsg: 2 ECU
+ SG_ Ext : 0|16@1+ (1,0) [0|65535] "" Vector__XXX
+
+VAL_ 256 Flag 0 "Off" 1 "On" ;
+`
+
+func writeDBC(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func loadTestDBC(t *testing.T) *dbcDatabase {
+	t.Helper()
+	db, err := loadDBCFiles([]string{writeDBC(t, "test.dbc", testDBC)})
+	if err != nil {
+		t.Fatalf("loadDBCFiles: %v", err)
+	}
+	return db
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func decodeByName(t *testing.T, msg *dbcMessage, payload string) map[string]decodedSignal {
+	t.Helper()
+	if msg == nil {
+		t.Fatal("message not found")
+	}
+	out := make(map[string]decodedSignal)
+	for _, sig := range msg.decode(mustHex(t, payload)) {
+		out[sig.Name] = sig
+	}
+	return out
+}
+
+func checkSignal(t *testing.T, sigs map[string]decodedSignal, name string, raw int64, value float64) {
+	t.Helper()
+	sig, ok := sigs[name]
+	if !ok {
+		t.Errorf("%s: not decoded", name)
+		return
+	}
+	if sig.Raw != raw || math.Abs(sig.Value-value) > 1e-9 {
+		t.Errorf("%s = raw %d value %v, want raw %d value %v", name, sig.Raw, sig.Value, raw, value)
+	}
+}
+
+func TestDecodeIntel(t *testing.T) {
+	db := loadTestDBC(t)
+	// Speed 0x0FA0 = 4000, Current 0xFF92 = -110, Flag bit 35, Odd 0xABC from bit 36
+	sigs := decodeByName(t, db.lookup(256, false), "A00F92FFC8AB0000")
+
+	checkSignal(t, sigs, "Speed", 4000, 400)
+	checkSignal(t, sigs, "Current", -110, -21)
+	checkSignal(t, sigs, "Flag", 1, 1)
+	checkSignal(t, sigs, "Odd", 0xABC, 0xABC)
+	if got := sigs["Flag"].Description; got != "On" {
+		t.Errorf("Flag description = %q, want On", got)
+	}
+}
+
+func TestDecodeMotorola(t *testing.T) {
+	db := loadTestDBC(t)
+	// Word 0x1234, Signed 0xFF92 = -110, High nibble 0xA of byte 4, Cross 12 bits
+	// from bit 34 (low bits of byte 4, then byte 5 and the top bits of byte 6)
+	sigs := decodeByName(t, db.lookup(257, false), "1234FF92A6CDE000")
+
+	checkSignal(t, sigs, "Word", 0x1234, 0x1234)
+	checkSignal(t, sigs, "Signed", -110, -55)
+	checkSignal(t, sigs, "High", 0xA, 0xA)
+	// byte 4 bits 2-0 = 110, byte 5 = 11001101, byte 6 bit 7 = 1
+	checkSignal(t, sigs, "Cross", 0b110110011011, 0b110110011011)
+}
+
+func TestDecodeMultiplexed(t *testing.T) {
+	db := loadTestDBC(t)
+	msg := db.lookup(258, false)
+
+	page0 := decodeByName(t, msg, "0007E803")
+	checkSignal(t, page0, "Page", 0, 0)
+	checkSignal(t, page0, "Common", 7, 7)
+	checkSignal(t, page0, "PageA", 1000, 1000)
+	if _, ok := page0["PageB"]; ok {
+		t.Error("PageB decoded on page 0")
+	}
+
+	page1 := decodeByName(t, msg, "0107FEFF")
+	checkSignal(t, page1, "PageB", -2, -4)
+	if _, ok := page1["PageA"]; ok {
+		t.Error("PageA decoded on page 1")
+	}
+}
+
+func TestDecodeShortFrame(t *testing.T) {
+	db := loadTestDBC(t)
+	sigs := decodeByName(t, db.lookup(256, false), "A00F92")
+	checkSignal(t, sigs, "Speed", 4000, 400)
+	if _, ok := sigs["Current"]; ok {
+		t.Error("Current decoded from a 3-byte frame")
+	}
+}
+
+func TestLookupFrameFormat(t *testing.T) {
+	db := loadTestDBC(t)
+	// BO_ 2147483904 is the extended ID 0x100, a different message than the standard 0x100
+	if msg := db.lookup(0x100, false); msg == nil || msg.Name != "IntelMsg" {
+		t.Errorf("lookup(0x100, standard) = %v, want IntelMsg", msg)
+	}
+	if msg := db.lookup(0x100, true); msg == nil || msg.Name != "ExtendedMsg" {
+		t.Errorf("lookup(0x100, extended) = %v, want ExtendedMsg", msg)
+	}
+	if msg := db.lookup(0x101, true); msg != nil {
+		t.Errorf("lookup(0x101, extended) = %s, want nil", msg.Name)
+	}
+}
+
+func TestSignExtend(t *testing.T) {
+	tests := []struct {
+		bits   uint64
+		length uint
+		want   int64
+	}{
+		{0x7F, 8, 127},
+		{0x80, 8, -128},
+		{0xFFFF, 16, -1},
+		{0x8, 4, -8},
+		{math.MaxUint64, 64, -1},
+	}
+	for _, tt := range tests {
+		if got := signExtend(tt.bits, tt.length); got != tt.want {
+			t.Errorf("signExtend(%#x, %d) = %d, want %d", tt.bits, tt.length, got, tt.want)
+		}
+	}
+}
+
+func TestLoadDuplicates(t *testing.T) {
+	first := writeDBC(t, "first.dbc", testDBC)
+	tests := map[string]string{
+		"same ID":   "VERSION \"\"\n\nNS_ :\n\nBS_:\n\nBU_: ECU\n\nBO_ 257 OtherMsg: 8 ECU\n SG_ X : 0|8@1+ (1,0) [0|255] \"\" Vector__XXX\n",
+		"same name": "VERSION \"\"\n\nNS_ :\n\nBS_:\n\nBU_: ECU\n\nBO_ 512 MuxMsg: 8 ECU\n SG_ X : 0|8@1+ (1,0) [0|255] \"\" Vector__XXX\n",
+	}
+	for name, content := range tests {
+		if _, err := loadDBCFiles([]string{first, writeDBC(t, "second.dbc", content)}); err == nil {
+			t.Errorf("%s: loadDBCFiles accepted a duplicate message", name)
+		}
+	}
+	// The same ID as an extended frame is a different message
+	ext := "VERSION \"\"\n\nNS_ :\n\nBS_:\n\nBU_: ECU\n\nBO_ 2147483905 OtherExt: 8 ECU\n SG_ X : 0|8@1+ (1,0) [0|255] \"\" Vector__XXX\n"
+	if _, err := loadDBCFiles([]string{first, writeDBC(t, "ext.dbc", ext)}); err != nil {
+		t.Errorf("extended 0x101: %v", err)
+	}
+}
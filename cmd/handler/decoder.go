@@ -1,541 +1,363 @@
 package main
 
 import (
-	"encoding/binary"
-	"encoding/hex"
 	"fmt"
-	"log"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
-)
 
-func decodeHexPayload(data string, expectedLen int) ([]byte, error) {
-	bytes, err := hex.DecodeString(data)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode hex payload: %w", err)
-	}
-	if expectedLen > 0 && len(bytes) != expectedLen {
-		return nil, fmt.Errorf("invalid data length: expected %d bytes, got %d", expectedLen, len(bytes))
-	}
-	return bytes, nil
-}
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/canframe"
+)
 
-func readUint16LE(b []byte, offset int) (uint16, error) {
-	if offset+2 > len(b) {
-		return 0, fmt.Errorf("offset %d out of range for %d byte slice", offset, len(b))
+// frameTimestamp formats the receive time of a frame for the LastUpdate fields.
+// Captures recorded without timestamps fall back to the handler clock.
+func frameTimestamp(msg CANMessage) string {
+	t := msg.Time()
+	if t.IsZero() {
+		t = time.Now()
 	}
-	return binary.LittleEndian.Uint16(b[offset : offset+2]), nil
+	return t.Format(time.RFC3339Nano)
 }
 
-func readInt16LE(b []byte, offset int) (int16, error) {
-	val, err := readUint16LE(b, offset)
-	return int16(val), err
+// decodeDBCFrame decodes a frame with its DBC definition and merges the signals
+// into SignalData. Signals of other multiplexer pages keep their last value.
+func (st *telemetryState) decodeDBCFrame(msg CANMessage, def *dbcMessage) []decodedSignal {
+	entry, ok := st.SignalData.Messages[def.Name]
+	if !ok {
+		entry = &SignalMessage{
+			ID:      canframe.FormatID(def.ID, def.Extended),
+			Source:  def.Source,
+			Signals: make(map[string]SignalValue, len(def.Signals)),
+		}
+		st.SignalData.Messages[def.Name] = entry
+	}
+
+	signals := def.decode(msg.Data)
+	values := make(map[string]SignalValue, len(signals))
+	for _, sig := range signals {
+		value := SignalValue{
+			Value:       sig.Value,
+			Raw:         sig.Raw,
+			Unit:        sig.Unit,
+			Description: sig.Description,
+		}
+		entry.Signals[sig.Name] = value
+		values[sig.Name] = value
+	}
+	entry.LastUpdate = frameTimestamp(msg)
+	entry.Count++
+
+	st.touch(docSignals)
+	st.emit(DecodedMessage{
+		Subject:   decodedSubject(def.Name),
+		ID:        entry.ID,
+		Name:      def.Name,
+		Timestamp: entry.LastUpdate,
+		Signals:   values,
+	})
+	return signals
 }
 
-// decode6B1 handles High Cell ID, Pack Current, and High Cell Voltage
-// 0x6B1 - 0015 FF92 9BF3 00ED
-//
-//	High Cell Id      -> 0015 = 21 -> 21
-//	Pack Current      -> FF92 = -110 -> -11.0A (Int16 ÷ 10)
-//	High Cell Voltage -> 9BF3 = 39,923 -> 3.9923 (/ 10000)
-func decode6B1(msg CANMessage) error {
-	if len(msg.Data) != 16 { // 8 bytes = 16 hex chars
-		return fmt.Errorf("invalid data length for 6B1: expected 16, got %d", len(msg.Data))
-	}
-
-	// Parse High Cell ID from bytes 0-1 (first 4 hex chars)
-	highCellIDHex := msg.Data[0:4]
-	highCellID, err := strconv.ParseInt(highCellIDHex, 16, 32)
-	if err != nil {
-		return fmt.Errorf("failed to parse high cell ID: %v", err)
-	}
+// signalSet indexes decoded signals by name with the given prefix removed.
+type signalSet map[string]decodedSignal
 
-	// Parse pack current from bytes 2-3 (chars 4-7)
-	packCurrentHex := msg.Data[4:8]
-	packCurrentRaw, err := strconv.ParseUint(packCurrentHex, 16, 16)
-	if err != nil {
-		return fmt.Errorf("failed to parse pack current: %v", err)
+func newSignalSet(prefix string, signals []decodedSignal) signalSet {
+	out := make(signalSet, len(signals))
+	for _, sig := range signals {
+		out[strings.TrimPrefix(sig.Name, prefix)] = sig
 	}
-
-	// Parse High Cell Voltage from bytes 4-5 (chars 8-11)
-	highCellVoltageHex := msg.Data[8:12]
-	highCellVoltageRaw, err := strconv.ParseInt(highCellVoltageHex, 16, 32)
-	if err != nil {
-		return fmt.Errorf("failed to parse high cell voltage: %v", err)
-	}
-
-	// Convert voltage: divide by 10000 to get correct value
-	highCellVoltage := float64(highCellVoltageRaw) / 10000.0
-	packCurrent := float64(int16(packCurrentRaw)) / 10.0
-
-	// Update cell data
-	cellData.HighCell.ID = int(highCellID)
-	cellData.HighCell.Voltage = highCellVoltage
-	cellData.PackData.PackCurrent = packCurrent
-	timestamp := time.Now().Format(time.RFC3339Nano)
-	cellData.LastUpdate.HighCell = timestamp
-	cellData.LastUpdate.PackCurrent = timestamp
-
-	// Write to JSON file
-	if err := writeJSONFile(); err != nil {
-		log.Printf("⚠️  Failed to write JSON: %v", err)
-	}
-
-	return nil
+	return out
 }
 
-// decode6B2 handles Low Cell ID, Auxiliary System Voltage, and Low Cell Voltage
-// 0x6B2 - 0046 0085 9BAA 0010
-//
-//	Low Cell Id      -> 0046 = 70 -> 70
-//	12V System Volt. -> 0085 = 133 -> 13.3V (/ 10)
-//	Low Cell Voltage -> 9901 = 39.169 -> 3.9169 (/ 10000)
-func decode6B2(msg CANMessage) error {
-	if len(msg.Data) != 16 { // 8 bytes = 16 hex chars
-		return fmt.Errorf("invalid data length for 6B2: expected 16, got %d", len(msg.Data))
-	}
-
-	// Parse Low Cell ID from bytes 0-1 (first 4 hex chars)
-	lowCellIDHex := msg.Data[0:4]
-	lowCellID, err := strconv.ParseInt(lowCellIDHex, 16, 32)
-	if err != nil {
-		return fmt.Errorf("failed to parse low cell ID: %v", err)
-	}
-
-	// Parse 12V system voltage from bytes 2-3 (chars 4-7)
-	auxVoltageHex := msg.Data[4:8]
-	auxVoltageRaw, err := strconv.ParseInt(auxVoltageHex, 16, 32)
-	if err != nil {
-		return fmt.Errorf("failed to parse auxiliary voltage: %v", err)
-	}
-
-	// Parse Low Cell Voltage from bytes 4-5 (chars 8-11)
-	lowCellVoltageHex := msg.Data[8:12]
-	lowCellVoltageRaw, err := strconv.ParseInt(lowCellVoltageHex, 16, 32)
-	if err != nil {
-		return fmt.Errorf("failed to parse low cell voltage: %v", err)
+// setFloat copies a signal value into dst when the signal was present in the frame.
+// Multiplexed messages such as DIx_temperature only carry some signals per page.
+func (s signalSet) setFloat(dst *float64, name string) bool {
+	sig, ok := s[name]
+	if ok {
+		*dst = sig.Value
 	}
-
-	// Convert voltage: divide by 10000 to get correct value
-	lowCellVoltage := float64(lowCellVoltageRaw) / 10000.0
-	auxVoltage := float64(auxVoltageRaw) / 10.0
-
-	// Update cell data
-	cellData.LowCell.ID = int(lowCellID)
-	cellData.LowCell.Voltage = lowCellVoltage
-	cellData.AuxVoltage = auxVoltage
-	cellData.LastUpdate.LowCell = time.Now().Format(time.RFC3339Nano)
-	cellData.LastUpdate.AuxVoltage = cellData.LastUpdate.LowCell
-
-	// Write to JSON file
-	if err := writeJSONFile(); err != nil {
-		log.Printf("⚠️  Failed to write JSON: %v", err)
-	}
-
-	return nil
+	return ok
 }
 
-// decode6B4 handles System Control Information
-// 0x6B4 - 0162 0004 1200 0000
-//
-//	Relay State -> 0162 = 0000 0001 0110 0010 (16-bit relay status)
-//	Pack CCL    -> 0004 = 4A (Charge Current Limit)
-//	Pack DCL    -> 1200 = 4608 (Discharge Current Limit - needs verification)
-func decode6B4(msg CANMessage) error {
-	if len(msg.Data) != 16 { // 8 bytes = 16 hex chars
-		return fmt.Errorf("invalid data length for 6B4: expected 16, got %d", len(msg.Data))
+// setText copies the VAL_ description of a signal, falling back to the raw value.
+func (s signalSet) setText(dst *string, name string) {
+	sig, ok := s[name]
+	if !ok {
+		return
 	}
-
-	// Parse Relay State from bytes 0-1 (first 4 hex chars) - 16-bit value
-	relayStateHex := msg.Data[0:4]
-	relayStateRaw, err := strconv.ParseInt(relayStateHex, 16, 32)
-	if err != nil {
-		return fmt.Errorf("failed to parse relay state: %v", err)
+	if sig.Description != "" {
+		*dst = sig.Description
+	} else {
+		*dst = formatRaw(sig.Raw)
 	}
-
-	// Parse Pack CCL from bytes 2-3 (chars 4-7)
-	packCCLHex := msg.Data[4:8]
-	packCCL, err := strconv.ParseInt(packCCLHex, 16, 32)
-	if err != nil {
-		return fmt.Errorf("failed to parse pack CCL: %v", err)
-	}
-
-	// Parse Pack DCL from bytes 4-5 (chars 8-11)
-	packDCLHex := msg.Data[8:12]
-	packDCL, err := strconv.ParseInt(packDCLHex, 16, 32)
-	if err != nil {
-		return fmt.Errorf("failed to parse pack DCL: %v", err)
-	}
-
-	// Decode relay state bits
-	relayState := RelayState{
-		DischargeRelay: (relayStateRaw & 0x01) != 0,   // Bit 0
-		ChargeRelay:    (relayStateRaw & 0x02) != 0,   // Bit 1
-		ChargerSafety:  (relayStateRaw & 0x04) != 0,   // Bit 2
-		MalfunctionDTC: (relayStateRaw & 0x08) != 0,   // Bit 3
-		MPInput1:       (relayStateRaw & 0x10) != 0,   // Bit 4
-		AlwaysOn:       (relayStateRaw & 0x20) != 0,   // Bit 5
-		IsReady:        (relayStateRaw & 0x40) != 0,   // Bit 6
-		IsCharging:     (relayStateRaw & 0x80) != 0,   // Bit 7
-		MPInput2:       (relayStateRaw & 0x0100) != 0, // Bit 8
-		MPInput3:       (relayStateRaw & 0x0200) != 0, // Bit 9
-		Reserved:       (relayStateRaw & 0x0400) != 0, // Bit 10
-		MPOutput2:      (relayStateRaw & 0x0800) != 0, // Bit 11
-		MPOutput3:      (relayStateRaw & 0x1000) != 0, // Bit 12
-		MPOutput4:      (relayStateRaw & 0x2000) != 0, // Bit 13
-		MPEnable:       (relayStateRaw & 0x4000) != 0, // Bit 14
-		MPOutput1:      (relayStateRaw & 0x8000) != 0, // Bit 15
-	}
-
-	// Update cell data
-	cellData.SystemControl.RelayState = relayState
-	// The BMS reports CCL/DCL using 0.1A resolution; convert to amps.
-	cellData.SystemControl.PackCCL = float64(packCCL) / 10.0
-	cellData.SystemControl.PackDCL = float64(packDCL) / 10.0
-	cellData.LastUpdate.SystemControl = time.Now().Format(time.RFC3339Nano)
-
-	// Write to JSON file
-	if err := writeJSONFile(); err != nil {
-		log.Printf("⚠️  Failed to write JSON: %v", err)
-	}
-
-	return nil
 }
 
-// decode6B3 handles Temperature Information
-// 0x6B3 - 0013 0000 0010 0000
-//
-//	High Temp -> 0013 = 19°C
-//	Low Temp  -> 0010 = 16°C
-func decode6B3(msg CANMessage) error {
-	if len(msg.Data) != 16 { // 8 bytes = 16 hex chars
-		return fmt.Errorf("invalid data length for 6B3: expected 16, got %d", len(msg.Data))
-	}
-
-	// Parse High Temperature from bytes 0-1 (first 4 hex chars)
-	highTempHex := msg.Data[0:4]
-	highTemp, err := strconv.ParseInt(highTempHex, 16, 32)
-	if err != nil {
-		return fmt.Errorf("failed to parse high temperature: %v", err)
-	}
-
-	// Parse Low Temperature from bytes 4-5 (chars 8-11)
-	lowTempHex := msg.Data[8:12]
-	lowTemp, err := strconv.ParseInt(lowTempHex, 16, 32)
-	if err != nil {
-		return fmt.Errorf("failed to parse low temperature: %v", err)
-	}
-
-	// Update temperature data
-	cellData.TemperatureData.HighTemp = int(highTemp)
-	cellData.TemperatureData.LowTemp = int(lowTemp)
-	cellData.LastUpdate.TemperatureData = time.Now().Format(time.RFC3339Nano)
-
-	// Write to JSON file
-	if err := writeJSONFile(); err != nil {
-		log.Printf("⚠️  Failed to write JSON: %v", err)
+func (s signalSet) setBool(dst *bool, name string) {
+	if sig, ok := s[name]; ok {
+		*dst = sig.Raw != 0
 	}
-
-	return nil
 }
 
-// decode6B0 handles Battery Pack Status
-// 0x6B0 - 00A100486E50005F
-//
-//	SOC          -> 00A1 = 161 -> 80.5% (161 × 10 ÷ 2)
-//	Cell Count   -> 0048 = 72 -> 72 (direct)
-//	Pack Voltage -> 6E50 = 28,240 -> 282.4V (28240 ÷ 100)
-func decode6B0(msg CANMessage) error {
-	if len(msg.Data) != 16 { // 8 bytes = 16 hex chars
-		return fmt.Errorf("invalid data length for 6B0: expected 16, got %d", len(msg.Data))
-	}
-
-	// Parse SOC from bytes 0-1 (first 4 hex chars)
-	socHex := msg.Data[0:4]
-	socRaw, err := strconv.ParseInt(socHex, 16, 32)
-	if err != nil {
-		return fmt.Errorf("failed to parse SOC: %v", err)
-	}
-
-	// Parse Cell Count from bytes 2-3 (chars 4-7)
-	cellCountHex := msg.Data[4:8]
-	cellCount, err := strconv.ParseInt(cellCountHex, 16, 32)
-	if err != nil {
-		return fmt.Errorf("failed to parse cell count: %v", err)
-	}
-
-	// Parse Pack Voltage from bytes 4-5 (chars 8-11)
-	packVoltageHex := msg.Data[8:12]
-	packVoltageRaw, err := strconv.ParseInt(packVoltageHex, 16, 32)
-	if err != nil {
-		return fmt.Errorf("failed to parse pack voltage: %v", err)
-	}
-
-	// Convert values according to documentation
-	soc := float64(socRaw*10) / 2.0                // 161 × 10 ÷ 2 = 80.5%
-	packVoltage := float64(packVoltageRaw) / 100.0 // 28240 ÷ 100 = 282.4V
-
-	// Update pack data
-	cellData.PackData.SOC = soc
-	cellData.PackData.CellCount = int(cellCount)
-	cellData.PackData.PackVoltage = packVoltage
-	cellData.LastUpdate.PackData = time.Now().Format(time.RFC3339Nano)
-
-	// Write to JSON file
-	if err := writeJSONFile(); err != nil {
-		log.Printf("⚠️  Failed to write JSON: %v", err)
-	}
-
-	return nil
+// int returns the scaled value of a signal as an integer, for IDs, counts and
+// whole-degree temperatures.
+func (s signalSet) int(name string) int {
+	return int(s[name].Value)
 }
 
-// decodeBmsLimits handles CAN ID 0x351 (BmsLimits)
-func decodeBmsLimits(msg CANMessage) error {
-	payload, err := decodeHexPayload(msg.Data, 8)
-	if err != nil {
-		return err
-	}
-
-	cv, err := readUint16LE(payload, 0)
-	if err != nil {
-		return err
-	}
-	cc, err := readUint16LE(payload, 2)
-	if err != nil {
-		return err
-	}
-	dc, err := readUint16LE(payload, 4)
-	if err != nil {
-		return err
-	}
-	dv, err := readUint16LE(payload, 6)
-	if err != nil {
-		return err
-	}
-
-	mainData.BmsLimits.ChargeVoltageLimit = float64(cv) / 10.0
-	mainData.BmsLimits.ChargeCurrentLimit = float64(cc) / 10.0
-	mainData.BmsLimits.DischargeCurrentLimit = float64(dc) / 10.0
-	mainData.BmsLimits.DischargeVoltageLimit = float64(dv) / 10.0
-	mainData.LastUpdate.BmsLimits = time.Now().Format(time.RFC3339Nano)
-	mainData.MessageCount.BmsLimits++
-
-	if err := writeMainDataFile(); err != nil {
-		log.Printf("⚠️  Failed to write main data: %v", err)
-	}
-	return nil
+func formatRaw(raw int64) string {
+	return "UNKNOWN_" + strconv.FormatInt(raw, 10)
 }
 
-// decodeBmsSOC handles CAN ID 0x355 (BmsSOC)
-func decodeBmsSOC(msg CANMessage) error {
-	payload, err := decodeHexPayload(msg.Data, 8)
-	if err != nil {
-		return err
-	}
-
-	socRaw, err := readUint16LE(payload, 0)
-	if err != nil {
-		return err
-	}
-	sohRaw, err := readUint16LE(payload, 2)
-	if err != nil {
-		return err
-	}
-	socHighRaw, err := readUint16LE(payload, 4)
-	if err != nil {
-		return err
-	}
-
-	mainData.BmsSOC.StateOfCharge = float64(socRaw)
-	mainData.BmsSOC.StateOfHealth = float64(sohRaw)
-	mainData.BmsSOC.StateOfChargeHighDef = float64(socHighRaw) / 10.0
-	mainData.LastUpdate.BmsSOC = time.Now().Format(time.RFC3339Nano)
-	mainData.MessageCount.BmsSOC++
-
-	if err := writeMainDataFile(); err != nil {
-		log.Printf("⚠️  Failed to write main data: %v", err)
-	}
-	return nil
-}
-
-// decodeBmsStatus1 handles CAN ID 0x356 (BmsStatus1)
-func decodeBmsStatus1(msg CANMessage) error {
-	payload, err := decodeHexPayload(msg.Data, 6)
-	if err != nil {
-		return err
-	}
-
-	packVoltRaw, err := readUint16LE(payload, 0)
-	if err != nil {
-		return err
-	}
-	packCurrentRaw, err := readInt16LE(payload, 2)
-	if err != nil {
-		return err
-	}
-	packTempRaw, err := readInt16LE(payload, 4)
-	if err != nil {
-		return err
-	}
-
-	mainData.BmsStatus1.PackVoltage = float64(packVoltRaw) / 10.0
-	mainData.BmsStatus1.PackCurrent = float64(packCurrentRaw) / 10.0
-	mainData.BmsStatus1.PackTemperature = float64(packTempRaw) / 10.0
-	mainData.LastUpdate.BmsStatus1 = time.Now().Format(time.RFC3339Nano)
-	mainData.MessageCount.BmsStatus1++
-
-	if err := writeMainDataFile(); err != nil {
-		log.Printf("⚠️  Failed to write main data: %v", err)
-	}
+// decodeTrackedFrame fills ev_data.json, main_data.json, cells.json and
+// thermistors.json from a DBC-decoded frame listed in trackedFrames. Other
+// frames are ignored; now is the frame receive time.
+func (st *telemetryState) decodeTrackedFrame(def *dbcMessage, signals []decodedSignal, now string) error {
+	info, ok := trackedFrames[def.Name]
+	if !ok {
+		return nil
+	}
+	if len(signals) < len(def.Signals) {
+		return fmt.Errorf("short frame: %d of %d signals present", len(signals), len(def.Signals))
+	}
+	sigs := newSignalSet("", signals)
+
+	switch def.Name {
+	case "BmsCellBroadcast":
+		st.decodeCellBroadcast(sigs, now)
+	case "BmsThermistorBroadcast":
+		st.decodeThermistorBroadcast(sigs, now)
+	default:
+		if info.Doc == docEVData {
+			st.decodeEVData(def.Name, sigs, now)
+		} else {
+			st.decodeMainData(def.Name, sigs, now)
+		}
+	}
+	st.touch(info.Doc)
 	return nil
 }
 
-// decodeBmsErrors handles CAN ID 0x35A (BmsErrors)
-func decodeBmsErrors(msg CANMessage) error {
-	payload, err := decodeHexPayload(msg.Data, 4)
-	if err != nil {
-		return err
-	}
-
-	raw := binary.LittleEndian.Uint32(payload)
-
-	mainData.BmsErrors.P0A06ChgLimitEnforceFault = (raw>>31)&1 == 1
-	mainData.BmsErrors.P0A05InputPSUFault = (raw>>30)&1 == 1
-	mainData.BmsErrors.P0AA6HVIsolationFault = (raw>>29)&1 == 1
-	mainData.BmsErrors.P0560RedundantPSUFault = (raw>>28)&1 == 1
-	mainData.BmsErrors.U0100ExternalComms = (raw>>27)&1 == 1
-	mainData.BmsErrors.P0A9CThermistorFault = (raw>>26)&1 == 1
-	mainData.BmsErrors.P0A81FanMonitorFault = (raw>>25)&1 == 1
-	mainData.BmsErrors.P0A02WeakPackFault = (raw>>24)&1 == 1
-	mainData.BmsErrors.P0A0FCellASICFault = (raw>>23)&1 == 1
-	mainData.BmsErrors.P0A0DHighCell5VFault = (raw>>22)&1 == 1
-	mainData.BmsErrors.P0AC0CurrentSensorFault = (raw>>21)&1 == 1
-	mainData.BmsErrors.P0A04OpenWiringFault = (raw>>20)&1 == 1
-	mainData.BmsErrors.P0AFALowCellVoltFault = (raw>>19)&1 == 1
-	mainData.BmsErrors.P0A80WeakCellFault = (raw>>18)&1 == 1
-	mainData.BmsErrors.P0A12CellBalanceOffFault = (raw>>17)&1 == 1
-	mainData.BmsErrors.P0A1FInternalCommsFault = (raw>>16)&1 == 1
-	mainData.BmsErrors.P0A10PackHotFault = (raw>>7)&1 == 1
-	mainData.BmsErrors.P0A0ELowCellFault = (raw>>6)&1 == 1
-	mainData.BmsErrors.P0A0CHighCellFault = (raw>>5)&1 == 1
-	mainData.BmsErrors.P0A0BIntSWFault = (raw>>4)&1 == 1
-	mainData.BmsErrors.P0A0AIntHeatsinkFault = (raw>>3)&1 == 1
-	mainData.BmsErrors.P0A09InternalHWFault = (raw>>2)&1 == 1
-	mainData.BmsErrors.P0A08ChgSafetyRelay = (raw>>1)&1 == 1
-	mainData.BmsErrors.P0A07DischgLimitEnforce = raw&1 == 1
-	mainData.LastUpdate.BmsErrors = time.Now().Format(time.RFC3339Nano)
-	mainData.MessageCount.BmsErrors++
-
-	if err := writeMainDataFile(); err != nil {
-		log.Printf("⚠️  Failed to write main data: %v", err)
+// decodeEVData applies one of the Orion BMS custom frames (0x6B0-0x6B4) to ev_data.json.
+func (st *telemetryState) decodeEVData(name string, sigs signalSet, now string) {
+	data := st.CellData
+	switch name {
+	case "BmsPackStatus":
+		// SOC is in tenths of a percent; the UI divides it by 10
+		sigs.setFloat(&data.PackData.SOC, "SOC")
+		data.PackData.CellCount = sigs.int("CellCount")
+		sigs.setFloat(&data.PackData.PackVoltage, "PackVoltage")
+		data.LastUpdate.PackData = now
+
+	case "BmsHighCell":
+		data.HighCell.ID = sigs.int("HighCellID")
+		sigs.setFloat(&data.HighCell.Voltage, "HighCellVoltage")
+		sigs.setFloat(&data.PackData.PackCurrent, "PackCurrent")
+		data.LastUpdate.HighCell = now
+		data.LastUpdate.PackCurrent = now
+
+	case "BmsLowCell":
+		data.LowCell.ID = sigs.int("LowCellID")
+		sigs.setFloat(&data.LowCell.Voltage, "LowCellVoltage")
+		sigs.setFloat(&data.AuxVoltage, "AuxVoltage")
+		data.LastUpdate.LowCell = now
+		data.LastUpdate.AuxVoltage = now
+
+	case "BmsTemperature":
+		data.TemperatureData.HighTemp = sigs.int("HighTemp")
+		data.TemperatureData.LowTemp = sigs.int("LowTemp")
+		data.LastUpdate.TemperatureData = now
+
+	case "BmsSystemControl":
+		relays := sigs["RelayState"].Raw
+		bit := func(n uint) bool { return relays>>n&1 != 0 }
+		data.SystemControl.RelayState = RelayState{
+			DischargeRelay: bit(0),
+			ChargeRelay:    bit(1),
+			ChargerSafety:  bit(2),
+			MalfunctionDTC: bit(3),
+			MPInput1:       bit(4),
+			AlwaysOn:       bit(5),
+			IsReady:        bit(6),
+			IsCharging:     bit(7),
+			MPInput2:       bit(8),
+			MPInput3:       bit(9),
+			Reserved:       bit(10),
+			MPOutput2:      bit(11),
+			MPOutput3:      bit(12),
+			MPOutput4:      bit(13),
+			MPEnable:       bit(14),
+			MPOutput1:      bit(15),
+		}
+		sigs.setFloat(&data.SystemControl.PackCCL, "PackCCL")
+		sigs.setFloat(&data.SystemControl.PackDCL, "PackDCL")
+		data.LastUpdate.SystemControl = now
 	}
-	return nil
 }
 
-// decodeBmsStatus2 handles CAN ID 0x35B (BmsStatus2)
-func decodeBmsStatus2(msg CANMessage) error {
-	payload, err := decodeHexPayload(msg.Data, 4)
-	if err != nil {
-		return err
+// decodeMainData applies one of the Zero EV BMS and drive-unit messages to main_data.json.
+func (st *telemetryState) decodeMainData(name string, sigs signalSet, now string) {
+	data := st.MainData
+	switch name {
+	case "BmsLimits":
+		limits := &data.BmsLimits
+		sigs.setFloat(&limits.ChargeVoltageLimit, "ChargeVoltageLimit")
+		sigs.setFloat(&limits.ChargeCurrentLimit, "ChargeCurrentLimit")
+		sigs.setFloat(&limits.DischargeCurrentLimit, "DischargeCurrentLimit")
+		sigs.setFloat(&limits.DischargeVoltageLimit, "DischargeVoltageLimit")
+		data.LastUpdate.BmsLimits = now
+		data.MessageCount.BmsLimits++
+
+	case "BmsSOC":
+		soc := &data.BmsSOC
+		sigs.setFloat(&soc.StateOfCharge, "HvBatterySOC")
+		sigs.setFloat(&soc.StateOfHealth, "HvBatterySOH")
+		sigs.setFloat(&soc.StateOfChargeHighDef, "HvBatterySOChighdef")
+		data.LastUpdate.BmsSOC = now
+		data.MessageCount.BmsSOC++
+
+	case "BmsStatus1":
+		status := &data.BmsStatus1
+		sigs.setFloat(&status.PackVoltage, "HvBatteryVoltage")
+		sigs.setFloat(&status.PackCurrent, "HvBatteryCurrent")
+		sigs.setFloat(&status.PackTemperature, "HvBatteryTemp")
+		data.LastUpdate.BmsStatus1 = now
+		data.MessageCount.BmsStatus1++
+
+	case "BMSCCSCommands":
+		sigs.setBool(&data.BmsCCSCommands.IsolationRelayOverride, "IsolationRelayOverride")
+		sigs.setFloat(&data.BmsCCSCommands.ACCurrentLimit, "ACCurrentLimit")
+		data.LastUpdate.BmsCCSCommands = now
+		data.MessageCount.BmsCCSCommands++
+
+	case "BmsErrors":
+		errs := &data.BmsErrors
+		sigs.setBool(&errs.P0A06ChgLimitEnforceFault, "P0A06_ChgLimitEnforceFault")
+		sigs.setBool(&errs.P0A05InputPSUFault, "P0A05_InputPSUFault")
+		sigs.setBool(&errs.P0AA6HVIsolationFault, "P0AA6_HVIsolationFault")
+		sigs.setBool(&errs.P0560RedundantPSUFault, "P0560_RedundantPSUFault")
+		sigs.setBool(&errs.U0100ExternalComms, "U0100_ExternalComms")
+		sigs.setBool(&errs.P0A9CThermistorFault, "P0A9C_ThermistorFault")
+		sigs.setBool(&errs.P0A81FanMonitorFault, "P0A81_FanMornitorFault")
+		sigs.setBool(&errs.P0A02WeakPackFault, "P0A02_WeakPackFault")
+		sigs.setBool(&errs.P0A0FCellASICFault, "P0A0F_CellASICFault")
+		sigs.setBool(&errs.P0A0DHighCell5VFault, "P0A0D_HighCell5VFault")
+		sigs.setBool(&errs.P0AC0CurrentSensorFault, "P0AC0_CurrentSensorFault")
+		sigs.setBool(&errs.P0A04OpenWiringFault, "P0A04_OpenWiringFault")
+		sigs.setBool(&errs.P0AFALowCellVoltFault, "P0AFA_LowCellVoltFault")
+		sigs.setBool(&errs.P0A80WeakCellFault, "P0A80_WeakCellFault")
+		sigs.setBool(&errs.P0A12CellBalanceOffFault, "P0A12_CellBallanceOffFault")
+		sigs.setBool(&errs.P0A1FInternalCommsFault, "P0A1F_InternalCommsFault")
+		sigs.setBool(&errs.P0A10PackHotFault, "P0A10_PackHotFault")
+		sigs.setBool(&errs.P0A0ELowCellFault, "P0A0E_LowCellFault")
+		sigs.setBool(&errs.P0A0CHighCellFault, "P0A0C_HighCellFault")
+		sigs.setBool(&errs.P0A0BIntSWFault, "P0A0B_IntSWFault")
+		sigs.setBool(&errs.P0A0AIntHeatsinkFault, "P0A0A_IntHeatsinkFault")
+		sigs.setBool(&errs.P0A09InternalHWFault, "P0A09_InternalHWFault")
+		sigs.setBool(&errs.P0A08ChgSafetyRelay, "P0A08_ChgSafetyRelay")
+		sigs.setBool(&errs.P0A07DischgLimitEnforce, "P0A07_DischgLimitEnforceFault")
+		data.LastUpdate.BmsErrors = now
+		data.MessageCount.BmsErrors++
+
+	case "BmsStatus2":
+		status := &data.BmsStatus2
+		sigs.setFloat(&status.IsolationADC, "IsolationADC")
+		sigs.setBool(&status.ReadyPower, "BMSFlag_Readypower")
+		sigs.setBool(&status.ChargePower, "BMSFlag_Chargepower")
+		sigs.setBool(&status.DischargeRelay, "BMSFlag_Dischargerelay")
+		sigs.setBool(&status.ChargeInterlock, "BMSFlag_Chargeinterlock")
+		sigs.setBool(&status.MPO1, "BMSFlag_MPO1")
+		sigs.setBool(&status.MPO2, "BMSFlag_MPO2")
+		sigs.setBool(&status.MPO3, "BMSFlag_MPO3")
+		sigs.setBool(&status.MPO4, "BMSFlag_MPO4")
+		data.LastUpdate.BmsStatus2 = now
+		data.MessageCount.BmsStatus2++
+
+	case "DU1Feedback":
+		feedback := &data.DU1Feedback
+		sigs.setFloat(&feedback.DCCurrent, "DU1DCCurrent")
+		sigs.setFloat(&feedback.BusVoltage, "DU1Voltage")
+		sigs.setFloat(&feedback.ThrottleTorqueRequest, "DU1ThrottleTorqueRequest")
+		sigs.setFloat(&feedback.ACCurrent, "DU1ACCurrent")
+		data.LastUpdate.DU1Feedback = now
+		data.MessageCount.DU1Feedback++
+
+	case "DU1Status":
+		status := &data.DU1Status
+		// The DBC declares the op mode signed; the dashboard shows the raw nibble
+		status.OpMode = uint8(sigs["DU1Opmode"].Raw) & 0x0F
+		status.Gear = uint8(sigs["DU1Gear"].Raw)
+		sigs.setBool(&status.Mode, "DU1Mode")
+		sigs.setBool(&status.DrivePowerLimited, "DU1DrivePwrLimited")
+		sigs.setBool(&status.Error, "DU1Error")
+		sigs.setBool(&status.BrakeRegenLightRequest, "DU1BrakeRegenLightRequest")
+		sigs.setFloat(&status.MotorSpeed, "DU1MotorSpeed")
+		sigs.setFloat(&status.InverterTemp, "DU1InverterTemp")
+		sigs.setFloat(&status.MotorTemp, "DU1MotorTemp")
+		data.LastUpdate.DU1Status = now
+		data.MessageCount.DU1Status++
+
+	case "DU1Diagnostic":
+		diag := &data.DU1Diagnostic
+		sigs.setBool(&diag.DCVoltageLimit, "DU_UDCLimit")
+		sigs.setBool(&diag.DCCurrentLimit, "DU_IDCLimit")
+		sigs.setBool(&diag.FrequencyLimit, "DU_Freqlimit")
+		sigs.setBool(&diag.AccelLimit, "DU_AccelLimit")
+		sigs.setBool(&diag.TempHeatsinkLimit, "DU_TMPHSLimit")
+		data.LastUpdate.DU1Diagnostic = now
+		data.MessageCount.DU1Diagnostic++
 	}
-
-	raw := binary.LittleEndian.Uint32(payload)
-	isoRaw := raw & 0xFFFF
-
-	mainData.BmsStatus2.IsolationADC = float64(isoRaw) * 0.001
-	mainData.BmsStatus2.ReadyPower = (raw>>16)&1 == 1
-	mainData.BmsStatus2.ChargePower = (raw>>17)&1 == 1
-	mainData.BmsStatus2.DischargeRelay = (raw>>18)&1 == 1
-	mainData.BmsStatus2.ChargeInterlock = (raw>>19)&1 == 1
-	mainData.BmsStatus2.MPO1 = (raw>>20)&1 == 1
-	mainData.BmsStatus2.MPO2 = (raw>>21)&1 == 1
-	mainData.BmsStatus2.MPO3 = (raw>>22)&1 == 1
-	mainData.BmsStatus2.MPO4 = (raw>>23)&1 == 1
-	mainData.LastUpdate.BmsStatus2 = time.Now().Format(time.RFC3339Nano)
-	mainData.MessageCount.BmsStatus2++
-
-	if err := writeMainDataFile(); err != nil {
-		log.Printf("⚠️  Failed to write main data: %v", err)
-	}
-	return nil
 }
 
-// decodeDU1Feedback handles CAN ID 0x125 (DU1Feedback)
-func decodeDU1Feedback(msg CANMessage) error {
-	payload, err := decodeHexPayload(msg.Data, 8)
-	if err != nil {
-		return err
-	}
-
-	dcRaw, err := readInt16LE(payload, 0)
-	if err != nil {
-		return err
-	}
-	voltageRaw, err := readUint16LE(payload, 2)
-	if err != nil {
-		return err
-	}
-	torqueRaw, err := readInt16LE(payload, 4)
-	if err != nil {
-		return err
-	}
-	acRaw, err := readInt16LE(payload, 6)
-	if err != nil {
-		return err
-	}
-
-	mainData.DU1Feedback.DCCurrent = float64(dcRaw) / 10.0
-	mainData.DU1Feedback.BusVoltage = float64(voltageRaw) / 10.0
-	mainData.DU1Feedback.ThrottleTorqueRequest = float64(torqueRaw)
-	mainData.DU1Feedback.ACCurrent = float64(acRaw) / 10.0
-	mainData.LastUpdate.DU1Feedback = time.Now().Format(time.RFC3339Nano)
-	mainData.MessageCount.DU1Feedback++
-
-	if err := writeMainDataFile(); err != nil {
-		log.Printf("⚠️  Failed to write main data: %v", err)
-	}
-	return nil
+// decodeCellBroadcast applies the Orion BMS 2 Battery Cell Broadcast (0x036),
+// one cell per frame, to cells.json.
+func (st *telemetryState) decodeCellBroadcast(sigs signalSet, now string) {
+	cellID := sigs.int("CellID")
+
+	// Grow the map as higher cell IDs are broadcast.
+	for len(st.CellMap.Cells) <= cellID {
+		st.CellMap.Cells = append(st.CellMap.Cells, CellVoltage{ID: len(st.CellMap.Cells)})
+	}
+
+	cell := CellVoltage{ID: cellID, LastUpdate: now}
+	sigs.setFloat(&cell.Voltage, "Voltage")
+	sigs.setFloat(&cell.OpenVoltage, "OpenVoltage")
+	sigs.setFloat(&cell.Resistance, "Resistance")
+	sigs.setBool(&cell.Balancing, "Balancing")
+	st.CellMap.Cells[cellID] = cell
+	st.CellMap.CellCount = len(st.CellMap.Cells)
+	st.CellMap.LastUpdate = now
+	st.CellMap.MessageCount++
 }
 
-// decodeDU1Status handles CAN ID 0x126 (DU1Status)
-func decodeDU1Status(msg CANMessage) error {
-	payload, err := decodeHexPayload(msg.Data, 8)
-	if err != nil {
-		return err
-	}
-
-	// Lower nibble of byte 0 holds the op mode.
-	mainData.DU1Status.OpMode = payload[0] & 0x0F
-
-	// Lower nibble of byte 1 holds gear selection.
-	mainData.DU1Status.Gear = payload[1] & 0x0F
-
-	mainData.DU1Status.Mode = (payload[1] & 0x10) != 0
-	mainData.DU1Status.DrivePowerLimited = (payload[1] & 0x20) != 0
-	mainData.DU1Status.Error = (payload[1] & 0x40) != 0
-	mainData.DU1Status.BrakeRegenLightRequest = (payload[1] & 0x80) != 0
-
-	motorSpeedRaw, err := readInt16LE(payload, 2)
-	if err != nil {
-		return err
-	}
-	inverterTempRaw, err := readInt16LE(payload, 4)
-	if err != nil {
-		return err
-	}
-	motorTempRaw, err := readInt16LE(payload, 6)
-	if err != nil {
-		return err
-	}
-
-	mainData.DU1Status.MotorSpeed = float64(motorSpeedRaw)
-	mainData.DU1Status.InverterTemp = float64(inverterTempRaw)
-	mainData.DU1Status.MotorTemp = float64(motorTempRaw)
-	mainData.LastUpdate.DU1Status = time.Now().Format(time.RFC3339Nano)
-	mainData.MessageCount.DU1Status++
-
-	if err := writeMainDataFile(); err != nil {
-		log.Printf("⚠️  Failed to write main data: %v", err)
-	}
-	return nil
+// decodeThermistorBroadcast applies the Orion BMS 2 Thermistor Broadcast (0x076),
+// one thermistor per frame, to thermistors.json.
+func (st *telemetryState) decodeThermistorBroadcast(sigs signalSet, now string) {
+	id := sigs.int("ThermistorID")
+	value := sigs.int("Temperature")
+
+	// Keep the table sorted by thermistor ID.
+	idx := sort.Search(len(st.ThermMap.Thermistors), func(i int) bool {
+		return st.ThermMap.Thermistors[i].ID >= id
+	})
+	if idx == len(st.ThermMap.Thermistors) || st.ThermMap.Thermistors[idx].ID != id {
+		st.ThermMap.Thermistors = append(st.ThermMap.Thermistors, ThermistorReading{})
+		copy(st.ThermMap.Thermistors[idx+1:], st.ThermMap.Thermistors[idx:])
+		st.ThermMap.Thermistors[idx] = ThermistorReading{ID: id, Min: value, Max: value}
+	}
+
+	reading := &st.ThermMap.Thermistors[idx]
+	reading.ModuleID = sigs.int("ModuleID")
+	reading.Value = value
+	reading.Min = min(reading.Min, value)
+	reading.Max = max(reading.Max, value)
+	reading.LastUpdate = now
+
+	st.ThermMap.LowTemp = sigs.int("LowestTemp")
+	st.ThermMap.HighTemp = sigs.int("HighestTemp")
+	st.ThermMap.HighID = sigs.int("HighestID")
+	st.ThermMap.LowID = sigs.int("LowestID")
+	st.ThermMap.ThermistorCount = len(st.ThermMap.Thermistors)
+	st.ThermMap.LastUpdate = now
+	st.ThermMap.MessageCount++
 }
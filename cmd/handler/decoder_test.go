@@ -0,0 +1,221 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// shippedDBC loads the DBC files of the default configuration.
+func shippedDBC(t *testing.T) *dbcDatabase {
+	t.Helper()
+	db, err := loadDBCFiles([]string{
+		"../../docs/OrionBMS2_custom.dbc",
+		"../../docs/ZeroEvDBC(onlyBMS&DU).dbc",
+	})
+	if err != nil {
+		t.Fatalf("loadDBCFiles: %v", err)
+	}
+	return db
+}
+
+// decodeFrames runs frames through the DBC and document decoders like the
+// handler does and returns the resulting state.
+func decodeFrames(t *testing.T, db *dbcDatabase, frames ...CANMessage) *telemetryState {
+	t.Helper()
+	store := newStateStore(nil)
+	for _, msg := range frames {
+		if err := msg.Normalize(); err != nil {
+			t.Fatal(err)
+		}
+		id, err := msg.CANID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		def := db.lookup(id, msg.Extended)
+		if def == nil {
+			t.Fatalf("no DBC message for %s", msg.ID)
+		}
+		store.Update(func(st *telemetryState) {
+			signals := st.decodeDBCFrame(msg, def)
+			if err := st.decodeTrackedFrame(def, signals, "t"); err != nil {
+				t.Fatalf("%s: %v", msg.ID, err)
+			}
+		})
+	}
+	return store.state
+}
+
+func near(got, want float64) bool {
+	return math.Abs(got-want) < 1e-9
+}
+
+func TestDecodeOrionFrames(t *testing.T) {
+	st := decodeFrames(t, shippedDBC(t),
+		CANMessage{ID: "6B0", Length: 8, Data: mustHex(t, "00A100486E50005F")},
+		CANMessage{ID: "6B1", Length: 8, Data: mustHex(t, "0015FF929BF300ED")},
+		CANMessage{ID: "6B2", Length: 8, Data: mustHex(t, "004600859BAA0010")},
+		CANMessage{ID: "6B3", Length: 8, Data: mustHex(t, "0013000000100000")},
+		CANMessage{ID: "6B4", Length: 8, Data: mustHex(t, "0162000412000000")},
+	)
+	data := st.CellData
+
+	if !near(data.PackData.SOC, 805) || data.PackData.CellCount != 72 || !near(data.PackData.PackVoltage, 282.4) {
+		t.Errorf("pack data = %+v", data.PackData)
+	}
+	if data.HighCell.ID != 21 || !near(data.HighCell.Voltage, 3.9923) || !near(data.PackData.PackCurrent, -11) {
+		t.Errorf("high cell = %+v, pack current %v", data.HighCell, data.PackData.PackCurrent)
+	}
+	if data.LowCell.ID != 70 || !near(data.LowCell.Voltage, 3.9850) || !near(data.AuxVoltage, 13.3) {
+		t.Errorf("low cell = %+v, aux voltage %v", data.LowCell, data.AuxVoltage)
+	}
+	if data.TemperatureData.HighTemp != 19 || data.TemperatureData.LowTemp != 16 {
+		t.Errorf("temperature = %+v", data.TemperatureData)
+	}
+	relays := data.SystemControl.RelayState
+	// 0x0162: bits 1, 5, 6 and 8
+	if relays.DischargeRelay || !relays.ChargeRelay || !relays.AlwaysOn || !relays.IsReady || !relays.MPInput2 || relays.MPOutput1 {
+		t.Errorf("relay state = %+v", relays)
+	}
+	if !near(data.SystemControl.PackCCL, 0.4) || !near(data.SystemControl.PackDCL, 460.8) {
+		t.Errorf("system control = %+v", data.SystemControl)
+	}
+	if data.LastUpdate.PackData != "t" || data.LastUpdate.AuxVoltage != "t" {
+		t.Errorf("last update = %+v", data.LastUpdate)
+	}
+	if got := st.SignalData.Messages["BmsPackStatus"]; got == nil || got.Count != 1 {
+		t.Errorf("signals.json BmsPackStatus = %+v", got)
+	}
+}
+
+func TestDecodeOrionBroadcasts(t *testing.T) {
+	st := decodeFrames(t, shippedDBC(t),
+		// legacy captures write "36" for 036
+		CANMessage{ID: "36", Length: 8, Data: mustHex(t, "149BF381239C0A5E")},
+		CANMessage{ID: "076", Length: 8, Data: mustHex(t, "000513050F160209")},
+		CANMessage{ID: "076", Length: 8, Data: mustHex(t, "0005F6050F160209")},
+	)
+
+	if len(st.CellMap.Cells) != 21 {
+		t.Fatalf("%d cells, want 21", len(st.CellMap.Cells))
+	}
+	cell := st.CellMap.Cells[20]
+	if cell.ID != 20 || !near(cell.Voltage, 3.9923) || !near(cell.OpenVoltage, 3.9946) || !near(cell.Resistance, 2.91) || !cell.Balancing {
+		t.Errorf("cell 20 = %+v", cell)
+	}
+
+	if len(st.ThermMap.Thermistors) != 1 {
+		t.Fatalf("%d thermistors, want 1", len(st.ThermMap.Thermistors))
+	}
+	therm := st.ThermMap.Thermistors[0]
+	if therm.ID != 5 || therm.ModuleID != 5 || therm.Value != -10 || therm.Min != -10 || therm.Max != 19 {
+		t.Errorf("thermistor = %+v", therm)
+	}
+	if st.ThermMap.LowTemp != 15 || st.ThermMap.HighTemp != 22 || st.ThermMap.HighID != 2 || st.ThermMap.LowID != 9 {
+		t.Errorf("thermistor summary = %+v", st.ThermMap)
+	}
+	if id := st.SignalData.Messages["BmsCellBroadcast"].ID; id != "036" {
+		t.Errorf("signals.json ID %q, want 036", id)
+	}
+}
+
+func TestDecodeZeroEVFrames(t *testing.T) {
+	st := decodeFrames(t, shippedDBC(t),
+		CANMessage{ID: "351", Length: 8, Data: mustHex(t, "6810E803D007A00F")},
+		CANMessage{ID: "356", Length: 6, Data: mustHex(t, "080B92FFFA00")},
+		CANMessage{ID: "35A", Length: 4, Data: mustHex(t, "81000080")},
+		CANMessage{ID: "126", Length: 8, Data: mustHex(t, "0F31E803FAFF1900")},
+	)
+	data := st.MainData
+
+	if !near(data.BmsLimits.ChargeVoltageLimit, 420) || !near(data.BmsLimits.ChargeCurrentLimit, 100) ||
+		!near(data.BmsLimits.DischargeCurrentLimit, 200) || !near(data.BmsLimits.DischargeVoltageLimit, 400) {
+		t.Errorf("limits = %+v", data.BmsLimits)
+	}
+	if !near(data.BmsStatus1.PackVoltage, 282.4) || !near(data.BmsStatus1.PackCurrent, -11) || !near(data.BmsStatus1.PackTemperature, 25) {
+		t.Errorf("status 1 = %+v", data.BmsStatus1)
+	}
+	errs := data.BmsErrors
+	if !errs.P0A07DischgLimitEnforce || !errs.P0A10PackHotFault || !errs.P0A06ChgLimitEnforceFault || errs.P0A08ChgSafetyRelay {
+		t.Errorf("errors = %+v", errs)
+	}
+	status := data.DU1Status
+	if status.OpMode != 0xF || status.Gear != 1 || !status.Mode || !status.DrivePowerLimited || status.Error ||
+		!near(status.MotorSpeed, 1000) || !near(status.InverterTemp, -6) || !near(status.MotorTemp, 25) {
+		t.Errorf("DU1 status = %+v", status)
+	}
+	if data.MessageCount.BmsLimits != 1 || data.LastUpdate.DU1Status != "t" {
+		t.Errorf("counts %+v, last update %+v", data.MessageCount, data.LastUpdate)
+	}
+}
+
+func TestDecodeTrackedShortFrame(t *testing.T) {
+	db := shippedDBC(t)
+	def := db.lookup(0x6B0, false)
+	store := newStateStore(nil)
+	store.Update(func(st *telemetryState) {
+		signals := st.decodeDBCFrame(CANMessage{ID: "6B0", Length: 4, Data: mustHex(t, "00A10048")}, def)
+		if err := st.decodeTrackedFrame(def, signals, "t"); err == nil {
+			t.Error("short 6B0 frame accepted")
+		}
+	})
+	if store.state.CellData.LastUpdate.PackData != "" {
+		t.Error("short frame updated ev_data.json")
+	}
+}
+
+func TestRouteByChannel(t *testing.T) {
+	vecan, err := loadDBCFiles([]string{"../../docs/VECAN_2.0.16_DI.dbc"})
+	if err != nil {
+		t.Fatalf("loadDBCFiles: %v", err)
+	}
+	r := &dbcRouter{channels: map[string]*dbcDatabase{"can1": vecan}, fallback: shippedDBC(t)}
+
+	for channel, want := range map[string]string{"can0": "DU1Status", "": "DU1Status", "can1": "DIR_hvStatus"} {
+		if msg := r.lookup(channel, 0x126, false); msg == nil || msg.Name != want {
+			t.Errorf("lookup(%q, 0x126) = %v, want %s", channel, msg, want)
+		}
+	}
+	if msg := r.lookup("can0", 0x118, false); msg != nil {
+		t.Errorf("lookup(can0, 0x118) = %s, want nil", msg.Name)
+	}
+
+	subjects := make(map[string]bool)
+	for _, subject := range decodedSubjects(r) {
+		subjects[subject] = true
+	}
+	// 0x126 is covered by the wildcard; filter subjects may not overlap
+	for subject, want := range map[string]bool{"can.raw.*.126": true, "can.raw.can1.126": false, "can.raw.can1.118": true, "can.raw.*.118": false} {
+		if subjects[subject] != want {
+			t.Errorf("subject %s listed = %v, want %v", subject, subjects[subject], want)
+		}
+	}
+}
+
+func TestShippedDBCConflicts(t *testing.T) {
+	// DIF_alertMatrix1 and DIR_hvStatus reuse Zero EV IDs, so VECAN needs its own channel
+	_, err := loadDBCFiles([]string{"../../docs/ZeroEvDBC(onlyBMS&DU).dbc", "../../docs/VECAN_2.0.16_DI.dbc"})
+	if err == nil {
+		t.Error("Zero EV and VECAN DBCs loaded into one channel")
+	}
+}
+
+func TestDescribeAlert(t *testing.T) {
+	tests := map[string]string{
+		"hwPhaseAgateDrive":       "Hw Phase A Gate Drive",
+		"phaseBrms":               "Phase B Rms",
+		"phaseAcurrentOffset":     "Phase A Current Offset",
+		"phaseCurrentBalance":     "Phase Current Balance",
+		"busVsensor":              "Bus V Sensor",
+		"busVoltageAnomaly":       "Bus Voltage Anomaly",
+		"safetyICFault":           "Safety IC Fault",
+		"12vSupplyOV":             "12v Supply OV",
+		"hw12vSupplyUV":           "Hw 12v Supply UV",
+		"SW_Brick_OV":             "SW Brick OV",
+		"SW_Incomplete_Hot_Seal_": "SW Incomplete Hot Seal",
+	}
+	for name, want := range tests {
+		if got := describeAlert(name); got != want {
+			t.Errorf("describeAlert(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/canframe"
+	"github.com/spf13/viper"
+)
+
+// Message states reported in freshness.json, signals.json and the status maps of
+// ev_data.json and main_data.json.
+const (
+	stateLearning = "learning" // no expected period known yet
+	stateLive     = "live"
+	stateStale    = "stale"
+	stateTimeout  = "timeout"
+)
+
+// learnSamples is the number of intervals averaged before a learned period is used.
+const learnSamples = 5
+
+// frameInfo describes a DBC message that also feeds a dashboard document: the
+// node that sends it and the ev_data/main_data sections (last_update keys) it fills.
+type frameInfo struct {
+	Node     string
+	Doc      stateDoc
+	Sections []string
+}
+
+// trackedFrames are decoded into ev_data.json, main_data.json, cells.json and
+// thermistors.json by decodeTrackedFrame, keyed by DBC message name.
+var trackedFrames = map[string]frameInfo{
+	"BmsPackStatus":          {"bms", docEVData, []string{"pack_data"}},
+	"BmsHighCell":            {"bms", docEVData, []string{"high_cell", "pack_current"}},
+	"BmsLowCell":             {"bms", docEVData, []string{"low_cell", "aux_voltage"}},
+	"BmsTemperature":         {"bms", docEVData, []string{"temperature_data"}},
+	"BmsSystemControl":       {"bms", docEVData, []string{"system_control"}},
+	"BmsCellBroadcast":       {"bms", docCells, nil},
+	"BmsThermistorBroadcast": {"bms", docThermistors, nil},
+	"BmsLimits":              {"bms", docMainData, []string{"bms_limits"}},
+	"BmsSOC":                 {"bms", docMainData, []string{"bms_soc"}},
+	"BmsStatus1":             {"bms", docMainData, []string{"bms_status_1"}},
+	"BMSCCSCommands":         {"bms", docMainData, []string{"bms_ccs_commands"}},
+	"BmsErrors":              {"bms", docMainData, []string{"bms_errors"}},
+	"BmsStatus2":             {"bms", docMainData, []string{"bms_status_2"}},
+	"DU1Feedback":            {"drive_unit", docMainData, []string{"du1_feedback"}},
+	"DU1Status":              {"drive_unit", docMainData, []string{"du1_status"}},
+	"DU1Diagnostic":          {"drive_unit", docMainData, []string{"du1_diagnostic"}},
+}
+
+// freshnessConfig holds the handler.freshness settings.
+type freshnessConfig struct {
+	CheckInterval  time.Duration
+	StaleFactor    float64                  // stale after this many missed periods
+	TimeoutFactor  float64                  // timed out after this many missed periods
+	MinStale       time.Duration            // lower bound for the stale threshold
+	UnknownTimeout time.Duration            // timeout for messages without a known period
+	MinPeriod      time.Duration            // the reader's change-only heartbeat; zero when every frame is published
+	Periods        map[string]time.Duration // configured periods by lower-case DBC message name; zero disables tracking
+	Nodes          map[string]string        // node overrides by lower-case DBC message name
+}
+
+// loadFreshnessConfig reads handler.freshness from the viper configuration.
+func loadFreshnessConfig() (freshnessConfig, error) {
+	viper.SetDefault("handler.freshness.check_interval", 250*time.Millisecond)
+	viper.SetDefault("handler.freshness.stale_factor", 3.0)
+	viper.SetDefault("handler.freshness.timeout_factor", 10.0)
+	viper.SetDefault("handler.freshness.min_stale", 500*time.Millisecond)
+	viper.SetDefault("handler.freshness.unknown_timeout", 5*time.Second)
+
+	cfg := freshnessConfig{
+		CheckInterval:  viper.GetDuration("handler.freshness.check_interval"),
+		StaleFactor:    viper.GetFloat64("handler.freshness.stale_factor"),
+		TimeoutFactor:  viper.GetFloat64("handler.freshness.timeout_factor"),
+		MinStale:       viper.GetDuration("handler.freshness.min_stale"),
+		UnknownTimeout: viper.GetDuration("handler.freshness.unknown_timeout"),
+		Periods:        make(map[string]time.Duration),
+		Nodes:          make(map[string]string),
+	}
+	if cfg.CheckInterval <= 0 {
+		return cfg, fmt.Errorf("handler.freshness.check_interval must be positive, got %v", cfg.CheckInterval)
+	}
+	// A reader in change-only mode repeats an unchanged payload only once per
+	// heartbeat, so no message is expected more often than that.
+	if viper.GetBool("reader.change_only.enabled") {
+		viper.SetDefault("reader.change_only.heartbeat", time.Second)
+		cfg.MinPeriod = viper.GetDuration("reader.change_only.heartbeat")
+	}
+
+	// Keyed by message name, as the same ID is a different message on another
+	// channel or as an extended frame. Viper lower-cases the keys.
+	for key, value := range viper.GetStringMapString("handler.freshness.periods") {
+		period, err := time.ParseDuration(value)
+		if err != nil {
+			return cfg, fmt.Errorf("handler.freshness.periods.%s: %w", key, err)
+		}
+		cfg.Periods[strings.ToLower(key)] = period
+	}
+	for key, node := range viper.GetStringMapString("handler.freshness.nodes") {
+		cfg.Nodes[strings.ToLower(key)] = node
+	}
+	return cfg, nil
+}
+
+// NodeEvent is published when a node goes silent or starts transmitting again.
+type NodeEvent struct {
+	Node      string `json:"node"`
+	State     string `json:"state"` // online or silent
+	Timestamp string `json:"timestamp"`
+	LastSeen  string `json:"last_seen"`
+}
+
+// timingKey identifies a message on one channel; the same ID on two buses is
+// timed separately.
+type timingKey struct {
+	Channel string
+	messageKey
+}
+
+// messageTiming tracks the arrival times of one DBC message.
+type messageTiming struct {
+	Channel      string
+	ID           uint32
+	Extended     bool
+	Name         string // DBC message name, the key in signals.json
+	Node         string
+	Info         *frameInfo
+	Period       time.Duration
+	PeriodSource string
+	Learned      time.Duration // moving average of the observed interval
+	Samples      int
+	Count        int
+	LastSeen     time.Time // when the handler processed the last frame
+	LastFrame    time.Time // reader timestamp of the last frame, for learning
+	State        string
+}
+
+type nodeTiming struct {
+	LastSeen time.Time
+	Silent   bool
+}
+
+// freshnessTracker learns message periods and detects overdue messages and silent nodes.
+type freshnessTracker struct {
+	cfg      freshnessConfig
+	messages map[timingKey]*messageTiming
+	nodes    map[string]*nodeTiming
+	pending  []NodeEvent // node events raised while decoding, sent on the next check
+	observed bool        // frames arrived since the last check
+}
+
+func newFreshnessTracker(cfg freshnessConfig) *freshnessTracker {
+	return &freshnessTracker{
+		cfg:      cfg,
+		messages: make(map[timingKey]*messageTiming),
+		nodes:    make(map[string]*nodeTiming),
+	}
+}
+
+// track starts timing a DBC message on a channel. It returns nil for messages
+// whose configured period is zero.
+func (ft *freshnessTracker) track(channel string, def *dbcMessage) *messageTiming {
+	key := strings.ToLower(def.Name)
+	period, configured := ft.cfg.Periods[key]
+	if configured && period <= 0 {
+		return nil
+	}
+
+	m := &messageTiming{Channel: channel, ID: def.ID, Extended: def.Extended, Name: def.Name}
+	if info, known := trackedFrames[def.Name]; known {
+		m.Info = &info
+		m.Node = info.Node
+	} else {
+		m.Node = def.Sender
+		if m.Node == "" {
+			m.Node = splitWords(def.Name)[0]
+		}
+		m.Node = strings.ToLower(strings.Join(splitWords(m.Node), "_"))
+	}
+	if node, ok := ft.cfg.Nodes[key]; ok {
+		m.Node = node
+	}
+
+	switch {
+	case configured:
+		m.Period, m.PeriodSource = period, "config"
+	case def.CycleTime > 0:
+		m.Period, m.PeriodSource = def.CycleTime, "dbc"
+	}
+
+	ft.messages[timingKey{channel, messageKey{ID: def.ID, Extended: def.Extended}}] = m
+	if ft.nodes[m.Node] == nil {
+		ft.nodes[m.Node] = &nodeTiming{}
+	}
+	return m
+}
+
+// learn folds an observed interval into the moving average (1/8 weight).
+func (m *messageTiming) learn(interval time.Duration) {
+	if m.Samples == 0 {
+		m.Learned = interval
+	} else {
+		m.Learned += (interval - m.Learned) / 8
+	}
+	m.Samples++
+	if m.PeriodSource == "" || m.PeriodSource == "learned" {
+		if m.Samples >= learnSamples {
+			m.Period, m.PeriodSource = m.Learned, "learned"
+		}
+	}
+}
+
+// evaluate returns the state of the message at the given time. The period is
+// raised to cfg.MinPeriod, as repeated frames only arrive once per heartbeat.
+func (m *messageTiming) evaluate(now time.Time, cfg *freshnessConfig) string {
+	age := now.Sub(m.LastSeen)
+	if m.Period <= 0 {
+		if age > max(cfg.UnknownTimeout, time.Duration(float64(cfg.MinPeriod)*cfg.TimeoutFactor)) {
+			return stateTimeout
+		}
+		return stateLearning
+	}
+	period := max(m.Period, cfg.MinPeriod)
+	stale := max(time.Duration(float64(period)*cfg.StaleFactor), cfg.MinStale)
+	timeout := max(time.Duration(float64(period)*cfg.TimeoutFactor), stale)
+	switch {
+	case age > timeout:
+		return stateTimeout
+	case age > stale:
+		return stateStale
+	}
+	return stateLive
+}
+
+// observeFrame records the arrival of a DBC message on a channel. Call it after
+// the frame was decoded so the signals.json entry exists. The period is learned
+// from the reader's frame timestamps, as the backlog replayed after a restart
+// arrives in a burst; frames without one use now.
+func (st *telemetryState) observeFrame(channel string, def *dbcMessage, frameTime, now time.Time) {
+	ft := st.freshness
+	if ft == nil {
+		return
+	}
+	m := ft.messages[timingKey{channel, messageKey{ID: def.ID, Extended: def.Extended}}]
+	if m == nil {
+		if m = ft.track(channel, def); m == nil {
+			return
+		}
+	}
+	if frameTime.IsZero() {
+		frameTime = now
+	}
+	if !m.LastFrame.IsZero() && frameTime.After(m.LastFrame) {
+		m.learn(frameTime.Sub(m.LastFrame))
+	}
+	m.LastFrame = frameTime
+	m.LastSeen = now
+	m.Count++
+	ft.observed = true
+
+	node := ft.nodes[m.Node]
+	node.LastSeen = now
+	if node.Silent {
+		node.Silent = false
+		ft.pending = append(ft.pending, NodeEvent{
+			Node:      m.Node,
+			State:     "online",
+			Timestamp: now.Format(time.RFC3339Nano),
+			LastSeen:  now.Format(time.RFC3339Nano),
+		})
+	}
+
+	if state := m.evaluate(now, &ft.cfg); state != m.State {
+		st.setMessageState(m, state)
+	}
+}
+
+// checkFreshness re-evaluates every tracked message, rebuilds freshness.json and
+// returns the node events raised since the previous check.
+func (st *telemetryState) checkFreshness(now time.Time) []NodeEvent {
+	ft := st.freshness
+	if ft == nil {
+		return nil
+	}
+
+	changed := ft.observed
+	ft.observed = false
+	for _, m := range ft.messages {
+		if state := m.evaluate(now, &ft.cfg); state != m.State {
+			st.setMessageState(m, state)
+			changed = true
+		}
+	}
+
+	// A node is silent once every message attributed to it has timed out.
+	for name, node := range ft.nodes {
+		silent := true
+		for _, m := range ft.messages {
+			if m.Node == name && m.State != stateTimeout {
+				silent = false
+				break
+			}
+		}
+		if silent && !node.Silent {
+			node.Silent = true
+			changed = true
+			ft.pending = append(ft.pending, NodeEvent{
+				Node:      name,
+				State:     "silent",
+				Timestamp: now.Format(time.RFC3339Nano),
+				LastSeen:  node.LastSeen.Format(time.RFC3339Nano),
+			})
+		}
+	}
+
+	if changed {
+		st.buildFreshnessData(now)
+	}
+
+	events := ft.pending
+	ft.pending = nil
+	return events
+}
+
+// setMessageState stores a new state and mirrors it into the documents the message feeds.
+func (st *telemetryState) setMessageState(m *messageTiming, state string) {
+	m.State = state
+	if m.Info != nil && len(m.Info.Sections) > 0 {
+		status := st.MainData.Status
+		if m.Info.Doc == docEVData {
+			status = st.CellData.Status
+		}
+		for _, section := range m.Info.Sections {
+			status[section] = state
+		}
+		st.touch(m.Info.Doc)
+	}
+	if entry, ok := st.SignalData.Messages[m.Name]; ok {
+		entry.State = state
+		st.touch(docSignals)
+	}
+}
+
+func (st *telemetryState) buildFreshnessData(now time.Time) {
+	ft := st.freshness
+	messages := make([]MessageFreshness, 0, len(ft.messages))
+	for _, m := range ft.messages {
+		messages = append(messages, MessageFreshness{
+			Channel:      m.Channel,
+			ID:           canframe.FormatID(m.ID, m.Extended),
+			Name:         m.Name,
+			Node:         m.Node,
+			PeriodMs:     float64(m.Period) / float64(time.Millisecond),
+			PeriodSource: m.PeriodSource,
+			State:        m.State,
+			Count:        m.Count,
+			LastSeen:     m.LastSeen.Format(time.RFC3339Nano),
+		})
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		if messages[i].ID != messages[j].ID {
+			return messages[i].ID < messages[j].ID
+		}
+		return messages[i].Channel < messages[j].Channel
+	})
+
+	nodes := make(map[string]NodeFreshness, len(ft.nodes))
+	for name, node := range ft.nodes {
+		state := "online"
+		if node.Silent {
+			state = "silent"
+		}
+		count := 0
+		for _, m := range ft.messages {
+			if m.Node == name {
+				count++
+			}
+		}
+		nodes[name] = NodeFreshness{State: state, LastSeen: node.LastSeen.Format(time.RFC3339Nano), Messages: count}
+	}
+
+	st.FreshData.Messages = messages
+	st.FreshData.Nodes = nodes
+	st.FreshData.LastUpdate = now.Format(time.RFC3339Nano)
+	st.touch(docFreshness)
+}
+
+// runFreshnessMonitor periodically checks for overdue messages and publishes node
+// events. It blocks, so run it in its own goroutine.
+func runFreshnessMonitor(ctx context.Context, store *stateStore, publisher *decodedPublisher, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var events []NodeEvent
+		store.Update(func(st *telemetryState) {
+			events = st.checkFreshness(time.Now())
+		})
+		for _, ev := range events {
+			if ev.State == "silent" {
+				log.Printf("⚠️  Node %s went silent (last frame %s)", ev.Node, ev.LastSeen)
+			} else {
+				log.Printf("Node %s is transmitting again", ev.Node)
+			}
+		}
+		publisher.PublishNodeEvents(events)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestLearnFromFrameTimestamps(t *testing.T) {
+	store := newStateStore(newFreshnessTracker(freshnessConfig{}))
+	def := &dbcMessage{ID: 0x351, Name: "BmsLimits"}
+
+	// A backlog replayed after a restart: frames sent 100 ms apart, processed at once
+	sent := time.Unix(1700000000, 0)
+	now := time.Now()
+	for i := 0; i <= learnSamples; i++ {
+		store.Update(func(st *telemetryState) {
+			st.observeFrame("can0", def, sent.Add(time.Duration(i)*100*time.Millisecond), now)
+		})
+	}
+
+	m := store.state.freshness.messages[timingKey{"can0", messageKey{ID: 0x351}}]
+	if m == nil {
+		t.Fatal("message not tracked")
+	}
+	if m.Period != 100*time.Millisecond || m.PeriodSource != "learned" {
+		t.Errorf("period = %v (%s), want 100ms learned", m.Period, m.PeriodSource)
+	}
+	if !m.LastSeen.Equal(now) {
+		t.Errorf("last seen = %v, want %v", m.LastSeen, now)
+	}
+}
+
+func TestOverridesByMessageName(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("handler.freshness.periods", map[string]interface{}{"DU1Status": "50ms", "DIR_hvStatus": "0"})
+	viper.Set("handler.freshness.nodes", map[string]interface{}{"DU1Status": "motor"})
+	cfg, err := loadFreshnessConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft := newFreshnessTracker(cfg)
+
+	// 0x126 is DU1Status on can0 and DIR_hvStatus on can1
+	du := ft.track("can0", &dbcMessage{ID: 0x126, Name: "DU1Status", Sender: "DriveUnit"})
+	if du == nil || du.Period != 50*time.Millisecond || du.PeriodSource != "config" || du.Node != "motor" {
+		t.Errorf("DU1Status timing = %+v", du)
+	}
+	if di := ft.track("can1", &dbcMessage{ID: 0x126, Name: "DIR_hvStatus"}); di != nil {
+		t.Errorf("DIR_hvStatus tracked with period 0: %+v", di)
+	}
+	ext := ft.track("can0", &dbcMessage{ID: 0x126, Extended: true, Name: "ChargerStatus"})
+	if ext == nil || ext.PeriodSource != "" || ext.Node != "charger" {
+		t.Errorf("extended 0x126 timing = %+v", ext)
+	}
+}
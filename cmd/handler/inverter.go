@@ -0,0 +1,124 @@
+package main
+
+import "strings"
+
+// Tesla drive-inverter messages from docs/VECAN_2.0.16_DI.dbc. The rear (DIR_) and
+// front (DIF_) units share the same message layouts, so they are matched by name
+// suffix after the unit prefix has been stripped.
+const (
+	inverterRearPrefix  = "DIR_"
+	inverterFrontPrefix = "DIF_"
+)
+
+// decodeInverterFrame updates the drive-inverter state from a DBC-decoded frame.
+// Frames that are not drive-inverter messages are ignored; now is the frame receive time.
+func (st *telemetryState) decodeInverterFrame(def *dbcMessage, signals []decodedSignal, now string) {
+	if st.InvData == nil || def == nil {
+		return
+	}
+
+	switch {
+	case def.Name == "DI_systemStatus":
+		sigs := newSignalSet("DI_", signals)
+		status := &st.InvData.SystemStatus
+		sigs.setText(&status.SystemState, "systemState")
+		sigs.setText(&status.Gear, "gear")
+		sigs.setText(&status.HVILStatus, "hvilSystemStatus")
+		sigs.setText(&status.ImmobilizerState, "immobilizerState")
+		if sig, ok := sigs["driveBlocked"]; ok {
+			status.DriveBlocked = int(sig.Raw)
+		}
+		sigs.setFloat(&status.AccelPedalPos, "accelPedalPos")
+		sigs.setBool(&status.AccelPedalPressed, "accelPedalPressed")
+		sigs.setBool(&status.Proximity, "proximity")
+		st.InvData.MessageCount.SystemStatus++
+		st.InvData.LastUpdate.SystemStatus = now
+
+	case def.Name == "DI_speed":
+		sigs := newSignalSet("DI_", signals)
+		sigs.setFloat(&st.InvData.Speed.Speed, "uiSpeed")
+		sigs.setText(&st.InvData.Speed.Units, "uiSpeedUnits")
+		st.InvData.MessageCount.Speed++
+		st.InvData.LastUpdate.Speed = now
+
+	case strings.HasPrefix(def.Name, inverterRearPrefix):
+		if !decodeDriveInverter(&st.InvData.Rear, strings.TrimPrefix(def.Name, inverterRearPrefix), newSignalSet(inverterRearPrefix, signals), now) {
+			return
+		}
+
+	case strings.HasPrefix(def.Name, inverterFrontPrefix):
+		if !decodeDriveInverter(&st.InvData.Front, strings.TrimPrefix(def.Name, inverterFrontPrefix), newSignalSet(inverterFrontPrefix, signals), now) {
+			return
+		}
+
+	default:
+		return
+	}
+
+	st.touch(docInverter)
+}
+
+// decodeDriveInverter applies one DIR_/DIF_ message to a drive-inverter unit and
+// reports whether the message is part of the inverter state model.
+func decodeDriveInverter(unit *DriveInverterData, message string, sigs signalSet, now string) bool {
+	switch message {
+	case "torque":
+		sigs.setFloat(&unit.Torque.TorqueCommand, "torqueCommand")
+		sigs.setFloat(&unit.Torque.TorqueActual, "torqueActual")
+		sigs.setFloat(&unit.Torque.AxleSpeed, "axleSpeed")
+		unit.MessageCount.Torque++
+		unit.LastUpdate.Torque = now
+
+	case "hvStatus":
+		sigs.setFloat(&unit.HVStatus.BusVoltage, "vBat")
+		sigs.setFloat(&unit.HVStatus.MotorCurrent, "motorCurrent")
+		unit.MessageCount.HVStatus++
+		unit.LastUpdate.HVStatus = now
+
+	case "power":
+		sigs.setFloat(&unit.Power.ElecPower, "elecPower")
+		sigs.setFloat(&unit.Power.DrivePowerMax, "drivePowerMax")
+		unit.MessageCount.Power++
+		unit.LastUpdate.Power = now
+
+	case "temperature":
+		// Only mux page 0 carries the temperatures; the other pages are ignored.
+		temp := &unit.Temperature
+		if !sigs.setFloat(&temp.PCBTemp, "pcbT") {
+			return false
+		}
+		sigs.setFloat(&temp.InverterTemp, "inverterT")
+		sigs.setFloat(&temp.StatorTemp, "statorT")
+		sigs.setFloat(&temp.DCCapTemp, "dcCapT")
+		sigs.setFloat(&temp.HeatsinkTemp, "heatsinkT")
+		sigs.setFloat(&temp.InverterPct, "inverterTpct")
+		sigs.setFloat(&temp.StatorPct, "statorTpct")
+		unit.MessageCount.Temperature++
+		unit.LastUpdate.Temperature = now
+
+	case "oilPump":
+		pump := &unit.OilPump
+		sigs.setText(&pump.State, "oilPumpState")
+		sigs.setFloat(&pump.FlowActual, "oilPumpFlowActual")
+		sigs.setFloat(&pump.FlowTarget, "oilPumpFlowTarget")
+		sigs.setFloat(&pump.FluidTemp, "oilPumpFluidT")
+		sigs.setFloat(&pump.PressureEstimate, "oilPumpPressureEstimate")
+		sigs.setFloat(&pump.PressureExpected, "oilPumpPressureExpected")
+		sigs.setFloat(&pump.PressureResidual, "oilPumpPressureResidual")
+		unit.MessageCount.OilPump++
+		unit.LastUpdate.OilPump = now
+
+	case "thermalControl":
+		ctrl := &unit.ThermalControl
+		sigs.setFloat(&ctrl.PassiveInletTempReq, "passiveInletTempReq")
+		sigs.setFloat(&ctrl.ActiveInletTempReq, "activeInletTempReq")
+		sigs.setFloat(&ctrl.CoolantFlowReq, "coolantFlowReq")
+		sigs.setFloat(&ctrl.OilFlowReq, "oilFlowReq")
+		unit.MessageCount.ThermalControl++
+		unit.LastUpdate.ThermalControl = now
+
+	default:
+		return false
+	}
+	return true
+}
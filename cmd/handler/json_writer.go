@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"math"
 	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -139,6 +142,182 @@ type DU1StatusData struct {
 	OpMode                 uint8   `json:"op_mode"`
 }
 
+// DU1DiagnosticData represents the limit flags from CAN ID 0x127.
+type DU1DiagnosticData struct {
+	TempHeatsinkLimit bool `json:"temp_heatsink_limit"`
+	AccelLimit        bool `json:"accel_limit"`
+	FrequencyLimit    bool `json:"frequency_limit"`
+	DCCurrentLimit    bool `json:"dc_current_limit"`
+	DCVoltageLimit    bool `json:"dc_voltage_limit"`
+}
+
+// BmsCCSCommandsData represents the CCS interface commands from CAN ID 0x357.
+type BmsCCSCommandsData struct {
+	ACCurrentLimit         float64 `json:"ac_current_limit"`
+	IsolationRelayOverride bool    `json:"isolation_relay_override"`
+}
+
+// DISystemStatusData represents DI_systemStatus (0x118) from the Tesla drive inverter.
+type DISystemStatusData struct {
+	SystemState       string  `json:"system_state"`
+	Gear              string  `json:"gear"`
+	HVILStatus        string  `json:"hvil_status"`
+	ImmobilizerState  string  `json:"immobilizer_state"`
+	DriveBlocked      int     `json:"drive_blocked"`
+	AccelPedalPos     float64 `json:"accel_pedal_pos"`
+	AccelPedalPressed bool    `json:"accel_pedal_pressed"`
+	Proximity         bool    `json:"proximity"`
+}
+
+// DISpeedData represents DI_speed (0x257).
+type DISpeedData struct {
+	Speed float64 `json:"speed"`
+	Units string  `json:"units"`
+}
+
+// InverterTorqueData represents DIx_torque (rear 0x108, front 0x186).
+type InverterTorqueData struct {
+	TorqueCommand float64 `json:"torque_command"`
+	TorqueActual  float64 `json:"torque_actual"`
+	AxleSpeed     float64 `json:"axle_speed"`
+}
+
+// InverterHVStatusData represents DIx_hvStatus (rear 0x126, front 0x1A5).
+type InverterHVStatusData struct {
+	BusVoltage   float64 `json:"bus_voltage"`
+	MotorCurrent float64 `json:"motor_current"`
+}
+
+// InverterPowerData represents DIx_power (rear 0x266, front 0x2E5).
+type InverterPowerData struct {
+	ElecPower     float64 `json:"elec_power"`
+	DrivePowerMax float64 `json:"drive_power_max"`
+}
+
+// InverterTemperatureData represents page 0 of DIx_temperature (rear 0x315, front 0x376).
+type InverterTemperatureData struct {
+	PCBTemp      float64 `json:"pcb_temp"`
+	InverterTemp float64 `json:"inverter_temp"`
+	StatorTemp   float64 `json:"stator_temp"`
+	DCCapTemp    float64 `json:"dc_cap_temp"`
+	HeatsinkTemp float64 `json:"heatsink_temp"`
+	InverterPct  float64 `json:"inverter_temp_pct"`
+	StatorPct    float64 `json:"stator_temp_pct"`
+}
+
+// InverterOilPumpData represents DIx_oilPump (rear 0x7FA, front 0x396).
+type InverterOilPumpData struct {
+	State            string  `json:"state"`
+	FlowActual       float64 `json:"flow_actual"`
+	FlowTarget       float64 `json:"flow_target"`
+	FluidTemp        float64 `json:"fluid_temp"`
+	PressureEstimate float64 `json:"pressure_estimate"`
+	PressureExpected float64 `json:"pressure_expected"`
+	PressureResidual float64 `json:"pressure_residual"`
+}
+
+// InverterThermalControlData represents DIx_thermalControl (rear 0x5D7, front 0x557).
+type InverterThermalControlData struct {
+	PassiveInletTempReq float64 `json:"passive_inlet_temp_req"`
+	ActiveInletTempReq  float64 `json:"active_inlet_temp_req"`
+	CoolantFlowReq      float64 `json:"coolant_flow_req"`
+	OilFlowReq          float64 `json:"oil_flow_req"`
+}
+
+// DriveInverterData holds the state of one Tesla drive inverter (rear DIR or front DIF).
+type DriveInverterData struct {
+	Torque         InverterTorqueData         `json:"torque"`
+	HVStatus       InverterHVStatusData       `json:"hv_status"`
+	Power          InverterPowerData          `json:"power"`
+	Temperature    InverterTemperatureData    `json:"temperature"`
+	OilPump        InverterOilPumpData        `json:"oil_pump"`
+	ThermalControl InverterThermalControlData `json:"thermal_control"`
+	MessageCount   struct {
+		Torque         int `json:"torque"`
+		HVStatus       int `json:"hv_status"`
+		Power          int `json:"power"`
+		Temperature    int `json:"temperature"`
+		OilPump        int `json:"oil_pump"`
+		ThermalControl int `json:"thermal_control"`
+	} `json:"message_count"`
+	LastUpdate struct {
+		Torque         string `json:"torque"`
+		HVStatus       string `json:"hv_status"`
+		Power          string `json:"power"`
+		Temperature    string `json:"temperature"`
+		OilPump        string `json:"oil_pump"`
+		ThermalControl string `json:"thermal_control"`
+	} `json:"last_update"`
+}
+
+// InverterDataJSON is the Tesla drive-inverter state saved to inverter_data.json.
+type InverterDataJSON struct {
+	Timestamp    string             `json:"timestamp"`
+	SystemStatus DISystemStatusData `json:"system_status"`
+	Speed        DISpeedData        `json:"speed"`
+	Rear         DriveInverterData  `json:"rear"`
+	Front        DriveInverterData  `json:"front"`
+	MessageCount struct {
+		SystemStatus int `json:"system_status"`
+		Speed        int `json:"speed"`
+	} `json:"message_count"`
+	LastUpdate struct {
+		SystemStatus string `json:"system_status"`
+		Speed        string `json:"speed"`
+	} `json:"last_update"`
+}
+
+// AlertEntry is one named alert-matrix fault with its set/clear history.
+type AlertEntry struct {
+	Name        string `json:"name"`        // DBC signal name, e.g. DIR_a008_hwEncoderA
+	Code        string `json:"code"`        // alert number, e.g. a008
+	Source      string `json:"source"`      // rear, front or bms
+	Message     string `json:"message"`     // alert-matrix message that carries the bit
+	Description string `json:"description"` // readable form of the signal name
+	Active      bool   `json:"active"`
+	SetCount    int    `json:"set_count"`
+	SetAt       string `json:"set_at"`
+	ClearedAt   string `json:"cleared_at,omitempty"`
+}
+
+// AlertDataJSON is the alert-matrix fault catalogue saved to alerts.json.
+// Only alerts that have been set at least once since start-up are listed.
+type AlertDataJSON struct {
+	Timestamp    string         `json:"timestamp"`
+	ActiveCount  int            `json:"active_count"`
+	Alerts       []AlertEntry   `json:"alerts"`
+	MessageCount map[string]int `json:"message_count"`
+	LastUpdate   string         `json:"last_update"`
+}
+
+// MessageFreshness reports whether one CAN message is still arriving on time.
+type MessageFreshness struct {
+	Channel      string  `json:"channel,omitempty"`
+	ID           string  `json:"id"`
+	Name         string  `json:"name"`
+	Node         string  `json:"node"`
+	PeriodMs     float64 `json:"period_ms"`     // expected period, 0 while still learning
+	PeriodSource string  `json:"period_source"` // config, dbc or learned
+	State        string  `json:"state"`         // learning, live, stale or timeout
+	Count        int     `json:"count"`
+	LastSeen     string  `json:"last_seen"`
+}
+
+// NodeFreshness reports whether a node (BMS, drive unit, ...) is still transmitting.
+type NodeFreshness struct {
+	State    string `json:"state"` // online or silent
+	LastSeen string `json:"last_seen"`
+	Messages int    `json:"messages"` // number of message IDs attributed to the node
+}
+
+// FreshnessJSON is the message-timeout overview saved to freshness.json.
+type FreshnessJSON struct {
+	Timestamp  string                   `json:"timestamp"`
+	Messages   []MessageFreshness       `json:"messages"`
+	Nodes      map[string]NodeFreshness `json:"nodes"`
+	LastUpdate string                   `json:"last_update"`
+}
+
 // CellDataJSON is the structure saved to ev_data.json
 type CellDataJSON struct {
 	Timestamp       string          `json:"timestamp"`
@@ -158,78 +337,241 @@ type CellDataJSON struct {
 		TemperatureData string `json:"temperature_data"`
 		SystemControl   string `json:"system_control"`
 	} `json:"last_update"`
+	Status map[string]string `json:"status"` // freshness per last_update key: live, stale or timeout
 }
 
 // MainDataJSON aggregates key BMS/drive-unit messages into main_data.json.
 type MainDataJSON struct {
-	Timestamp    string          `json:"timestamp"`
-	BmsLimits    BmsLimitsData   `json:"bms_limits"`
-	BmsSOC       BmsSOCData      `json:"bms_soc"`
-	BmsStatus1   BmsStatus1Data  `json:"bms_status_1"`
-	BmsErrors    BmsErrorsData   `json:"bms_errors"`
-	BmsStatus2   BmsStatus2Data  `json:"bms_status_2"`
-	DU1Feedback  DU1FeedbackData `json:"du1_feedback"`
-	DU1Status    DU1StatusData   `json:"du1_status"`
-	MessageCount struct {
-		BmsLimits   int `json:"bms_limits"`
-		BmsSOC      int `json:"bms_soc"`
-		BmsStatus1  int `json:"bms_status_1"`
-		BmsErrors   int `json:"bms_errors"`
-		BmsStatus2  int `json:"bms_status_2"`
-		DU1Feedback int `json:"du1_feedback"`
-		DU1Status   int `json:"du1_status"`
+	Timestamp      string             `json:"timestamp"`
+	BmsLimits      BmsLimitsData      `json:"bms_limits"`
+	BmsSOC         BmsSOCData         `json:"bms_soc"`
+	BmsStatus1     BmsStatus1Data     `json:"bms_status_1"`
+	BmsCCSCommands BmsCCSCommandsData `json:"bms_ccs_commands"`
+	BmsErrors      BmsErrorsData      `json:"bms_errors"`
+	BmsStatus2     BmsStatus2Data     `json:"bms_status_2"`
+	DU1Feedback    DU1FeedbackData    `json:"du1_feedback"`
+	DU1Status      DU1StatusData      `json:"du1_status"`
+	DU1Diagnostic  DU1DiagnosticData  `json:"du1_diagnostic"`
+	MessageCount   struct {
+		BmsLimits      int `json:"bms_limits"`
+		BmsSOC         int `json:"bms_soc"`
+		BmsStatus1     int `json:"bms_status_1"`
+		BmsCCSCommands int `json:"bms_ccs_commands"`
+		BmsErrors      int `json:"bms_errors"`
+		BmsStatus2     int `json:"bms_status_2"`
+		DU1Feedback    int `json:"du1_feedback"`
+		DU1Status      int `json:"du1_status"`
+		DU1Diagnostic  int `json:"du1_diagnostic"`
 	} `json:"message_count"`
 	LastUpdate struct {
-		BmsLimits   string `json:"bms_limits"`
-		BmsSOC      string `json:"bms_soc"`
-		BmsStatus1  string `json:"bms_status_1"`
-		BmsErrors   string `json:"bms_errors"`
-		BmsStatus2  string `json:"bms_status_2"`
-		DU1Feedback string `json:"du1_feedback"`
-		DU1Status   string `json:"du1_status"`
+		BmsLimits      string `json:"bms_limits"`
+		BmsSOC         string `json:"bms_soc"`
+		BmsStatus1     string `json:"bms_status_1"`
+		BmsCCSCommands string `json:"bms_ccs_commands"`
+		BmsErrors      string `json:"bms_errors"`
+		BmsStatus2     string `json:"bms_status_2"`
+		DU1Feedback    string `json:"du1_feedback"`
+		DU1Status      string `json:"du1_status"`
+		DU1Diagnostic  string `json:"du1_diagnostic"`
 	} `json:"last_update"`
+	Status map[string]string `json:"status"` // freshness per last_update key: live, stale or timeout
 }
 
-var (
-	cellData *CellDataJSON
-	mainData *MainDataJSON
-)
+// CellVoltage represents one cell from the 0x036 Battery Cell Broadcast
+type CellVoltage struct {
+	ID          int     `json:"id"`
+	Voltage     float64 `json:"voltage"`
+	OpenVoltage float64 `json:"open_voltage"`
+	Resistance  float64 `json:"resistance_mohm"`
+	Balancing   bool    `json:"balancing"`
+	LastUpdate  string  `json:"last_update"`
+}
 
-// writeJSONFile writes the current cell data to ev_data.json
-func writeJSONFile() error {
-	if cellData == nil {
-		return fmt.Errorf("no cell data to write")
-	}
+// CellMapJSON is the structure saved to cells.json
+type CellMapJSON struct {
+	Timestamp      string        `json:"timestamp"`
+	CellCount      int           `json:"cell_count"`
+	HighCell       CellData      `json:"high_cell"`
+	LowCell        CellData      `json:"low_cell"`
+	AverageVoltage float64       `json:"average_voltage"`
+	CellDelta      float64       `json:"cell_delta"`
+	BalancingCount int           `json:"balancing_count"`
+	Cells          []CellVoltage `json:"cells"`
+	MessageCount   int           `json:"message_count"`
+	LastUpdate     string        `json:"last_update"`
+}
 
-	// Update timestamp and calculate delta (rounded to 4 decimals)
-	cellData.Timestamp = time.Now().Format(time.RFC3339Nano)
-	delta := cellData.HighCell.Voltage - cellData.LowCell.Voltage
-	cellData.CellDelta = math.Round(delta*10000) / 10000
+// ThermistorReading represents one thermistor from the 0x076 Thermistor Broadcast
+type ThermistorReading struct {
+	ID         int    `json:"id"`
+	ModuleID   int    `json:"module_id"`
+	Value      int    `json:"value"`
+	Min        int    `json:"min"`
+	Max        int    `json:"max"`
+	LastUpdate string `json:"last_update"`
+}
+
+// ThermistorMapJSON is the structure saved to thermistors.json
+type ThermistorMapJSON struct {
+	Timestamp       string              `json:"timestamp"`
+	ThermistorCount int                 `json:"thermistor_count"`
+	HighTemp        int                 `json:"high_temp"`
+	HighID          int                 `json:"high_id"`
+	LowTemp         int                 `json:"low_temp"`
+	LowID           int                 `json:"low_id"`
+	Thermistors     []ThermistorReading `json:"thermistors"`
+	MessageCount    int                 `json:"message_count"`
+	LastUpdate      string              `json:"last_update"`
+}
+
+// SignalValue is one generically decoded DBC signal.
+type SignalValue struct {
+	Value       float64 `json:"value"`
+	Raw         int64   `json:"raw"`
+	Unit        string  `json:"unit,omitempty"`
+	Description string  `json:"description,omitempty"`
+}
+
+// SignalMessage holds the latest decoded signals of one DBC message.
+type SignalMessage struct {
+	ID         string                 `json:"id"`
+	Source     string                 `json:"source"`
+	Count      int                    `json:"count"`
+	LastUpdate string                 `json:"last_update"`
+	State      string                 `json:"state,omitempty"` // live, stale or timeout
+	Signals    map[string]SignalValue `json:"signals"`
+}
 
+// SignalDataJSON is the structure saved to signals.json, keyed by DBC message name.
+type SignalDataJSON struct {
+	Timestamp string                    `json:"timestamp"`
+	Messages  map[string]*SignalMessage `json:"messages"`
+}
+
+// dataFiles maps each state document to the file it is written to.
+var dataFiles = [docCount]string{
+	docEVData:      "ev_data.json",
+	docMainData:    "main_data.json",
+	docSignals:     "signals.json",
+	docCells:       "cells.json",
+	docThermistors: "thermistors.json",
+	docInverter:    "inverter_data.json",
+	docAlerts:      "alerts.json",
+	docFreshness:   "freshness.json",
+}
+
+// runFileSink writes every document to dataFolder once at startup and then each
+// document that changed since it was last written, at most once per interval. It
+// blocks, so run it in its own goroutine; when ctx is done it writes the changes
+// once more and returns.
+func runFileSink(ctx context.Context, store *stateStore, dataFolder string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// No document is written yet, so the first flush writes all of them and the
+	// UI finds a file even for documents that never change
+	var written [docCount]uint64
+	for doc := range written {
+		written[doc] = math.MaxUint64
+	}
+	flush := func() {
+		snap := store.Snapshot()
+		for doc := stateDoc(0); doc < docCount; doc++ {
+			if snap.Versions[doc] == written[doc] {
+				continue
+			}
+			if err := writeDataFile(dataFolder, dataFiles[doc], snap.Document(doc)); err != nil {
+				log.Printf("⚠️  Failed to write %s: %v", dataFiles[doc], err)
+				continue
+			}
+			written[doc] = snap.Versions[doc]
+		}
+	}
+	flush()
+	for {
+		select {
+		case <-ctx.Done():
+			flush() // final snapshot
+			return
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// writeDataFile encodes one document to dataFolder/name. The JSON is written to a
+// temporary file and renamed into place, so readers never see a partial document.
+func writeDataFile(dataFolder, name string, doc interface{}) error {
 	// Create data directory if it doesn't exist
-	if err := os.MkdirAll("data", 0755); err != nil {
+	if err := os.MkdirAll(dataFolder, 0755); err != nil {
 		return fmt.Errorf("failed to create data directory: %v", err)
 	}
 
-	// Write to file
-	file, err := os.Create("data/ev_data.json")
+	tmp, err := os.CreateTemp(dataFolder, "."+name+".*.tmp")
 	if err != nil {
-		return fmt.Errorf("failed to create ev_data.json: %v", err)
+		return fmt.Errorf("failed to create temp file for %s: %v", name, err)
 	}
-	defer file.Close()
+	defer os.Remove(tmp.Name()) // no-op once renamed
 
-	encoder := json.NewEncoder(file)
+	encoder := json.NewEncoder(tmp)
 	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(cellData); err != nil {
-		return fmt.Errorf("failed to encode JSON: %v", err)
+	if err := encoder.Encode(doc); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to encode %s: %v", name, err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set permissions on %s: %v", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
 	}
 
+	if err := os.Rename(tmp.Name(), filepath.Join(dataFolder, name)); err != nil {
+		return fmt.Errorf("failed to replace %s: %v", name, err)
+	}
 	return nil
 }
 
-// initCellData initializes the cell data structure
-func initCellData() {
-	cellData = &CellDataJSON{
+// summarizeCellData calculates the cell delta for ev_data.json (rounded to 4 decimals).
+func summarizeCellData(cellData *CellDataJSON) {
+	delta := cellData.HighCell.Voltage - cellData.LowCell.Voltage
+	cellData.CellDelta = math.Round(delta*10000) / 10000
+}
+
+// summarizeCellMap recalculates high/low/average over the cells reported so far.
+func summarizeCellMap(cellMap *CellMapJSON) {
+	var (
+		sum      float64
+		reported int
+	)
+	cellMap.BalancingCount = 0
+	for _, cell := range cellMap.Cells {
+		if cell.LastUpdate == "" {
+			continue
+		}
+		if reported == 0 || cell.Voltage > cellMap.HighCell.Voltage {
+			cellMap.HighCell = CellData{ID: cell.ID, Voltage: cell.Voltage}
+		}
+		if reported == 0 || cell.Voltage < cellMap.LowCell.Voltage {
+			cellMap.LowCell = CellData{ID: cell.ID, Voltage: cell.Voltage}
+		}
+		if cell.Balancing {
+			cellMap.BalancingCount++
+		}
+		sum += cell.Voltage
+		reported++
+	}
+	if reported == 0 {
+		return
+	}
+	cellMap.AverageVoltage = math.Round(sum/float64(reported)*10000) / 10000
+	cellMap.CellDelta = math.Round((cellMap.HighCell.Voltage-cellMap.LowCell.Voltage)*10000) / 10000
+}
+
+// newCellData initializes the cell data structure
+func newCellData() *CellDataJSON {
+	return &CellDataJSON{
 		Timestamp: time.Now().Format(time.RFC3339Nano),
 		PackData: PackData{
 			SOC:         0.0,
@@ -250,39 +592,63 @@ func initCellData() {
 			PackCCL:    0,
 			PackDCL:    0,
 		},
+		Status: make(map[string]string),
 	}
 }
 
-// writeMainDataFile writes the aggregated BMS/drive-unit data to main_data.json.
-func writeMainDataFile() error {
-	if mainData == nil {
-		return fmt.Errorf("no main data to write")
+// newMainData initializes the main data structure.
+func newMainData() *MainDataJSON {
+	return &MainDataJSON{
+		Timestamp: time.Now().Format(time.RFC3339Nano),
+		Status:    make(map[string]string),
 	}
+}
 
-	mainData.Timestamp = time.Now().Format(time.RFC3339Nano)
+// newSignalData initializes the generic DBC signal table.
+func newSignalData() *SignalDataJSON {
+	return &SignalDataJSON{
+		Timestamp: time.Now().Format(time.RFC3339Nano),
+		Messages:  make(map[string]*SignalMessage),
+	}
+}
 
-	if err := os.MkdirAll("data", 0755); err != nil {
-		return fmt.Errorf("failed to create data directory: %v", err)
+// newCellMap initializes the per-cell voltage map.
+func newCellMap() *CellMapJSON {
+	return &CellMapJSON{
+		Timestamp: time.Now().Format(time.RFC3339Nano),
+		Cells:     []CellVoltage{},
 	}
+}
 
-	file, err := os.Create("data/main_data.json")
-	if err != nil {
-		return fmt.Errorf("failed to create main_data.json: %v", err)
+// newThermistorMap initializes the per-thermistor temperature table.
+func newThermistorMap() *ThermistorMapJSON {
+	return &ThermistorMapJSON{
+		Timestamp:   time.Now().Format(time.RFC3339Nano),
+		Thermistors: []ThermistorReading{},
 	}
-	defer file.Close()
+}
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(mainData); err != nil {
-		return fmt.Errorf("failed to encode main data JSON: %v", err)
+// newInverterData initializes the drive-inverter data structure.
+func newInverterData() *InverterDataJSON {
+	return &InverterDataJSON{
+		Timestamp: time.Now().Format(time.RFC3339Nano),
 	}
+}
 
-	return nil
+// newAlertData initializes the alert-matrix fault catalogue.
+func newAlertData() *AlertDataJSON {
+	return &AlertDataJSON{
+		Timestamp:    time.Now().Format(time.RFC3339Nano),
+		Alerts:       []AlertEntry{},
+		MessageCount: make(map[string]int),
+	}
 }
 
-// initMainData initializes the main data structure.
-func initMainData() {
-	mainData = &MainDataJSON{
+// newFreshnessData initializes the message-timeout overview.
+func newFreshnessData() *FreshnessJSON {
+	return &FreshnessJSON{
 		Timestamp: time.Now().Format(time.RFC3339Nano),
+		Messages:  []MessageFreshness{},
+		Nodes:     make(map[string]NodeFreshness),
 	}
 }
@@ -1,104 +1,173 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/canframe"
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/natsconf"
 	"github.com/nats-io/nats.go"
+	"github.com/spf13/viper"
 )
 
 // CANMessage is the generic structure we receive from the bus
-type CANMessage struct {
-	ID     string      `json:"id"`
-	Length int         `json:"length"`
-	Data   string      `json:"data"`
-	Meta   interface{} `json:"meta"`
-}
+type CANMessage = canframe.Frame
 
 func main() {
-	// Initialize cell data structure
-	initCellData()
-	initMainData()
+	// Load configuration
+	viper.SetConfigName("config")
+	viper.SetConfigType("yaml")
+	viper.AddConfigPath(".")
+	viper.SetDefault("paths.data_folder", "data")
+	viper.SetDefault("handler.write_interval", time.Second)
+	viper.SetDefault("handler.decoded_subject_prefix", "ev.decoded")
+	viper.SetDefault("handler.event_subject_prefix", "ev.events")
+
+	if err := viper.ReadInConfig(); err != nil {
+		log.Fatalf("Error reading config file: %v", err)
+	}
+
+	// Load the DBC files of every channel used for generic signal decoding
+	dbcs, err := loadDBCRouter()
+	if err != nil {
+		log.Fatalf("Failed to load DBC files: %v", err)
+	}
 
-	nc, err := nats.Connect(nats.DefaultURL)
+	// Decoded state is owned by the store; the file sink flushes it to the data folder
+	dataFolder := viper.GetString("paths.data_folder")
+	writeInterval := viper.GetDuration("handler.write_interval")
+	if writeInterval <= 0 {
+		log.Fatalf("handler.write_interval must be positive, got %v", writeInterval)
+	}
+	freshnessCfg, err := loadFreshnessConfig()
+	if err != nil {
+		log.Fatalf("Invalid freshness config: %v", err)
+	}
+	store := newStateStore(newFreshnessTracker(freshnessCfg))
+
+	// SIGINT and SIGTERM (systemctl stop) start an ordered shutdown: stop
+	// consuming, write the final snapshot, then flush NATS
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	sinkCtx, stopSink := context.WithCancel(context.Background())
+	sinkDone := make(chan struct{})
+	go func() {
+		defer close(sinkDone)
+		runFileSink(sinkCtx, store, dataFolder, writeInterval)
+	}()
+
+	natsCfg, err := natsconf.Load("handler")
+	if err != nil {
+		log.Fatalf("Invalid NATS config: %v", err)
+	}
+	// Frames arrive on can.raw.<channel>.<id>, or on can.raw and can.raw.<channel> from readers in the older layouts
+	subjects := []string{"can.raw", "can.raw.>"}
+	streamCfg, err := natsconf.LoadStream(subjects...)
+	if err != nil {
+		log.Fatalf("Invalid NATS config: %v", err)
+	}
+	consumerCfg, err := loadConsumerConfig()
+	if err != nil {
+		log.Fatalf("Invalid handler config: %v", err)
+	}
+	nc, err := natsCfg.Connect(
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			log.Printf("Disconnected from NATS: %v", err)
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			log.Printf("Reconnected to NATS at %s", nc.ConnectedUrlRedacted())
+		}),
+	)
 	if err != nil {
 		log.Fatalf("Failed to connect to NATS: %v", err)
 	}
-	defer nc.Drain()
 
-	subject := "can.raw"
-	_, err = nc.Subscribe(subject, func(m *nats.Msg) {
+	// Decoded messages are also published as JSON for other consumers
+	publisher := &decodedPublisher{
+		nc:          nc,
+		prefix:      viper.GetString("handler.decoded_subject_prefix"),
+		eventPrefix: viper.GetString("handler.event_subject_prefix"),
+	}
+	go runFreshnessMonitor(ctx, store, publisher, freshnessCfg.CheckInterval)
+
+	handleFrame := func(m *nats.Msg) {
+		// JSON or binary, as named by the header; frames without it are JSON
 		var canMsg CANMessage
-		if err := json.Unmarshal(m.Data, &canMsg); err != nil {
-			log.Printf("Invalid JSON: %s", string(m.Data))
+		if err := canframe.Decode(m.Header.Get(canframe.ContentTypeHeader), m.Data, &canMsg); err != nil {
+			log.Printf("Invalid frame on %s: %v", m.Subject, err)
 			return
 		}
 
-		// Filter for tracked CAN IDs that we decode into JSON
-		switch canMsg.ID {
-		case "6B0":
-			if err := decode6B0(canMsg); err != nil {
-				log.Printf("Error decoding 6B0: %v", err)
-			}
-		case "6B1":
-			if err := decode6B1(canMsg); err != nil {
-				log.Printf("Error decoding 6B1: %v", err)
-			}
-		case "6B2":
-			if err := decode6B2(canMsg); err != nil {
-				log.Printf("Error decoding 6B2: %v", err)
-			}
-		case "6B3":
-			if err := decode6B3(canMsg); err != nil {
-				log.Printf("Error decoding 6B3: %v", err)
-			}
-		case "6B4":
-			if err := decode6B4(canMsg); err != nil {
-				log.Printf("Error decoding 6B4: %v", err)
-			}
-		case "351":
-			if err := decodeBmsLimits(canMsg); err != nil {
-				log.Printf("Error decoding 351: %v", err)
-			}
-		case "355":
-			if err := decodeBmsSOC(canMsg); err != nil {
-				log.Printf("Error decoding 355: %v", err)
-			}
-		case "356":
-			if err := decodeBmsStatus1(canMsg); err != nil {
-				log.Printf("Error decoding 356: %v", err)
-			}
-		case "35A":
-			if err := decodeBmsErrors(canMsg); err != nil {
-				log.Printf("Error decoding 35A: %v", err)
-			}
-		case "35B":
-			if err := decodeBmsStatus2(canMsg); err != nil {
-				log.Printf("Error decoding 35B: %v", err)
-			}
-		case "125":
-			if err := decodeDU1Feedback(canMsg); err != nil {
-				log.Printf("Error decoding 125: %v", err)
-			}
-		case "126":
-			if err := decodeDU1Status(canMsg); err != nil {
-				log.Printf("Error decoding 126: %v", err)
-			}
-		default:
-			// Ignore all other messages
+		// Older captures write "36" for 036 and carry no extended flag
+		if err := canMsg.Normalize(); err != nil {
+			log.Printf("Invalid frame: %v", err)
+			return
+		}
+		// Error and remote frames carry no signals
+		if canMsg.Error || canMsg.RTR {
+			return
+		}
+		id, err := canMsg.CANID()
+		if err != nil {
+			log.Printf("Error parsing CAN ID: %v", err)
 			return
 		}
-	})
+		// Only frames described by the DBC files of their channel are decoded
+		def := dbcs.lookup(canMsg.Channel, id, canMsg.Extended)
+		if def == nil {
+			return
+		}
+
+		decoded := store.Update(func(st *telemetryState) {
+			// Timing is recorded after decoding so signals.json already has the message
+			defer st.observeFrame(canMsg.Channel, def, canMsg.Time(), time.Now())
+
+			// Every frame described by a loaded DBC goes into signals.json, then
+			// into the dashboard, inverter and alert documents it feeds
+			signals := st.decodeDBCFrame(canMsg, def)
+			timestamp := frameTimestamp(canMsg)
+			if err := st.decodeTrackedFrame(def, signals, timestamp); err != nil {
+				log.Printf("Error decoding %s (%s): %v", canMsg.ID, def.Name, err)
+			}
+			st.decodeInverterFrame(def, signals, timestamp)
+			st.decodeAlertFrame(def, signals, timestamp)
+		})
+		publisher.Publish(decoded)
+	}
 
+	js, err := nc.JetStream()
 	if err != nil {
-		log.Fatalf("Failed to subscribe: %v", err)
+		log.Fatalf("Error initializing JetStream: %v", err)
+	}
+	consumer := &frameConsumer{js: js, stream: streamCfg, cfg: consumerCfg}
+	if consumerCfg.FilterIDs {
+		consumer.filter = decodedSubjects(dbcs)
+		log.Printf("Consuming only the %d channel and CAN ID subjects decoded here", len(consumer.filter)-2)
 	}
 
-	log.Printf("CAN Handler started - listening on '%s'", subject)
-	log.Println("Filtering for CAN IDs: 6B0 (Pack Status), 6B1 (High Cell), 6B2 (Low Cell), 6B3 (Temperature), 6B4 (System Control)")
-	log.Println("Additional IDs captured: 351 (BmsLimits), 355 (BmsSOC), 356 (BmsStatus1), 35A (BmsErrors), 35B (BmsStatus2), 125 (DU1Feedback), 126 (DU1Status)")
-	log.Println("Decoded data is written to data/ev_data.json and data/main_data.json")
+	log.Printf("CAN Handler started - consuming %v from stream %s as %s", subjects, streamCfg.Name, consumerCfg.Durable)
+	log.Println("Orion BMS and Zero EV drive-unit messages feed ev_data, main_data, cells and thermistors .json")
+	log.Println("Tesla drive inverter (DI_/DIR_/DIF_) state and alert matrices are tracked from the VECAN DBC")
+	if publisher.prefix != "" {
+		log.Printf("Decoded messages are published on '%s.>'", publisher.prefix)
+	}
+	if publisher.eventPrefix != "" {
+		log.Printf("Node silent/online events are published on '%s.node.>'", publisher.eventPrefix)
+	}
+	log.Printf("Decoded data is written to %s (ev_data, main_data, cells, thermistors, inverter_data, alerts and signals .json) every %v", dataFolder, writeInterval)
 
-	// Keep the program running
-	select {}
+	// Process frames until the program is stopped
+	consumer.run(ctx, handleFrame)
+
+	log.Println("Shutting down: writing the final data files")
+	stopSink()
+	<-sinkDone
+	if err := natsconf.Close(nc, 2*time.Second); err != nil {
+		log.Printf("Error flushing NATS: %v", err)
+	}
+	log.Println("CAN Handler stopped")
 }
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/nats-io/nats.go"
+)
+
+// DecodedMessage is one decoded CAN frame as published on <prefix>.<group>.<name>,
+// e.g. ev.decoded.bms.limits for BmsLimits (0x351).
+type DecodedMessage struct {
+	Subject   string                 `json:"-"`
+	ID        string                 `json:"id"`
+	Name      string                 `json:"name"`
+	Timestamp string                 `json:"timestamp"`
+	Signals   map[string]SignalValue `json:"signals"`
+}
+
+// emit queues a decoded message; stateStore.Update hands the queue to the caller.
+func (st *telemetryState) emit(msg DecodedMessage) {
+	st.events = append(st.events, msg)
+}
+
+// decodedPublisher publishes decoded messages and node events on NATS. A nil
+// publisher or an empty prefix disables the corresponding publishing.
+type decodedPublisher struct {
+	nc          *nats.Conn
+	prefix      string
+	eventPrefix string
+}
+
+func (p *decodedPublisher) Publish(msgs []DecodedMessage) {
+	if p == nil || p.prefix == "" {
+		return
+	}
+	for _, msg := range msgs {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			log.Printf("⚠️  Failed to encode %s: %v", msg.Name, err)
+			continue
+		}
+		if err := p.nc.Publish(p.prefix+"."+msg.Subject, data); err != nil {
+			log.Printf("⚠️  Failed to publish %s: %v", msg.Name, err)
+		}
+	}
+}
+
+// PublishNodeEvents publishes node events on <eventPrefix>.node.<node>.
+func (p *decodedPublisher) PublishNodeEvents(events []NodeEvent) {
+	if p == nil || p.eventPrefix == "" {
+		return
+	}
+	for _, ev := range events {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			log.Printf("⚠️  Failed to encode node event for %s: %v", ev.Node, err)
+			continue
+		}
+		if err := p.nc.Publish(p.eventPrefix+".node."+ev.Node, data); err != nil {
+			log.Printf("⚠️  Failed to publish node event for %s: %v", ev.Node, err)
+		}
+	}
+}
+
+// decodedSubject derives a subject suffix from a DBC message name: the first word
+// becomes the group and the rest the message, e.g. "BmsLimits" -> "bms.limits",
+// "DU1Status" -> "du1.status", "DI_systemStatus" -> "di.system_status".
+func decodedSubject(name string) string {
+	words := splitWords(name)
+	for i := range words {
+		words[i] = strings.ToLower(words[i])
+	}
+	if len(words) < 2 {
+		return strings.Join(words, "")
+	}
+	return words[0] + "." + strings.Join(words[1:], "_")
+}
+
+// splitWords splits an identifier on underscores and camel-case boundaries, keeping
+// acronyms together: "BMSCCSCommands" -> [BMSCCS Commands], "DU1Status" -> [DU1 Status].
+func splitWords(name string) []string {
+	var (
+		words []string
+		word  []rune
+	)
+	runes := []rune(name)
+	for i, r := range runes {
+		if r == '_' {
+			if len(word) > 0 {
+				words = append(words, string(word))
+				word = nil
+			}
+			continue
+		}
+		if len(word) > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				words = append(words, string(word))
+				word = nil
+			}
+		}
+		word = append(word, r)
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
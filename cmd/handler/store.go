@@ -0,0 +1,281 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// stateDoc identifies one JSON document held by the state store.
+type stateDoc int
+
+const (
+	docEVData      stateDoc = iota // ev_data.json
+	docMainData                    // main_data.json
+	docSignals                     // signals.json
+	docCells                       // cells.json
+	docThermistors                 // thermistors.json
+	docInverter                    // inverter_data.json
+	docAlerts                      // alerts.json
+	docFreshness                   // freshness.json
+	docCount
+)
+
+// telemetryState holds the mutable decoded documents. It is only accessed by
+// decoders running inside stateStore.Update, which serialises them.
+type telemetryState struct {
+	CellData   *CellDataJSON
+	MainData   *MainDataJSON
+	SignalData *SignalDataJSON
+	CellMap    *CellMapJSON
+	ThermMap   *ThermistorMapJSON
+	InvData    *InverterDataJSON
+	AlertData  *AlertDataJSON
+	FreshData  *FreshnessJSON
+
+	freshness *freshnessTracker
+	changed   [docCount]bool
+	events    []DecodedMessage // messages decoded by the current update
+}
+
+// touch marks a document as modified by the current update.
+func (st *telemetryState) touch(doc stateDoc) {
+	st.changed[doc] = true
+}
+
+// Snapshot is an immutable copy of the decoded telemetry. Sinks may keep and
+// encode it concurrently but must never modify it.
+type Snapshot struct {
+	Version  uint64           // increases with every update that changed a document
+	Versions [docCount]uint64 // store version at which each document last changed
+
+	CellData   *CellDataJSON
+	MainData   *MainDataJSON
+	SignalData *SignalDataJSON
+	CellMap    *CellMapJSON
+	ThermMap   *ThermistorMapJSON
+	InvData    *InverterDataJSON
+	AlertData  *AlertDataJSON
+	FreshData  *FreshnessJSON
+}
+
+// Document returns the snapshot copy of one document for generic sinks.
+func (s *Snapshot) Document(doc stateDoc) interface{} {
+	switch doc {
+	case docEVData:
+		return s.CellData
+	case docMainData:
+		return s.MainData
+	case docSignals:
+		return s.SignalData
+	case docCells:
+		return s.CellMap
+	case docThermistors:
+		return s.ThermMap
+	case docInverter:
+		return s.InvData
+	case docAlerts:
+		return s.AlertData
+	case docFreshness:
+		return s.FreshData
+	}
+	return nil
+}
+
+// stateStore owns the decoded telemetry. Decoders mutate it through Update and
+// output sinks (files, HTTP, NATS) read it through Snapshot without racing them.
+type stateStore struct {
+	mu          sync.Mutex
+	state       *telemetryState
+	version     uint64
+	docVersions [docCount]uint64
+	snapshot    *Snapshot // cached until the next change
+}
+
+func newStateStore(freshness *freshnessTracker) *stateStore {
+	return &stateStore{
+		state: &telemetryState{
+			CellData:   newCellData(),
+			MainData:   newMainData(),
+			SignalData: newSignalData(),
+			CellMap:    newCellMap(),
+			ThermMap:   newThermistorMap(),
+			InvData:    newInverterData(),
+			AlertData:  newAlertData(),
+			FreshData:  newFreshnessData(),
+			freshness:  freshness,
+		},
+	}
+}
+
+// Update runs fn with exclusive access to the state. Documents touched by fn get
+// their derived fields and timestamp refreshed. The messages decoded by fn are
+// returned for publishing outside the lock.
+func (s *stateStore) Update(fn func(st *telemetryState)) []DecodedMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.state
+	st.changed = [docCount]bool{}
+	st.events = nil
+	fn(st)
+	events := st.events
+	st.events = nil
+
+	changed := false
+	now := time.Now().Format(time.RFC3339Nano)
+	for doc := stateDoc(0); doc < docCount; doc++ {
+		if !st.changed[doc] {
+			continue
+		}
+		if !changed {
+			s.version++
+			changed = true
+		}
+		s.docVersions[doc] = s.version
+		st.finalize(doc, now)
+	}
+	return events
+}
+
+// finalize refreshes the timestamp and derived values of a modified document.
+func (st *telemetryState) finalize(doc stateDoc, now string) {
+	switch doc {
+	case docEVData:
+		st.CellData.Timestamp = now
+		summarizeCellData(st.CellData)
+	case docMainData:
+		st.MainData.Timestamp = now
+	case docSignals:
+		st.SignalData.Timestamp = now
+	case docCells:
+		st.CellMap.Timestamp = now
+		summarizeCellMap(st.CellMap)
+	case docThermistors:
+		st.ThermMap.Timestamp = now
+	case docInverter:
+		st.InvData.Timestamp = now
+	case docAlerts:
+		st.AlertData.Timestamp = now
+	case docFreshness:
+		st.FreshData.Timestamp = now
+	}
+}
+
+// Snapshot returns an immutable copy of the current state. Documents that did
+// not change since the previous snapshot are shared with it instead of copied.
+func (s *stateStore) Snapshot() *Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev := s.snapshot
+	if prev != nil && prev.Version == s.version {
+		return prev
+	}
+
+	snap := &Snapshot{}
+	if prev != nil {
+		*snap = *prev
+	}
+	snap.Version, snap.Versions = s.version, s.docVersions
+	for doc := stateDoc(0); doc < docCount; doc++ {
+		if prev != nil && prev.Versions[doc] == s.docVersions[doc] {
+			continue
+		}
+		switch doc {
+		case docEVData:
+			snap.CellData = s.state.CellData.clone()
+		case docMainData:
+			snap.MainData = s.state.MainData.clone()
+		case docSignals:
+			snap.SignalData = s.state.SignalData.clone()
+		case docCells:
+			snap.CellMap = s.state.CellMap.clone()
+		case docThermistors:
+			snap.ThermMap = s.state.ThermMap.clone()
+		case docInverter:
+			snap.InvData = s.state.InvData.clone()
+		case docAlerts:
+			snap.AlertData = s.state.AlertData.clone()
+		case docFreshness:
+			snap.FreshData = s.state.FreshData.clone()
+		}
+	}
+	s.snapshot = snap
+	return snap
+}
+
+func (d *CellDataJSON) clone() *CellDataJSON {
+	c := *d
+	c.Status = cloneStatus(d.Status)
+	return &c
+}
+
+func (d *MainDataJSON) clone() *MainDataJSON {
+	c := *d
+	c.Status = cloneStatus(d.Status)
+	return &c
+}
+
+func cloneStatus(status map[string]string) map[string]string {
+	c := make(map[string]string, len(status))
+	for key, state := range status {
+		c[key] = state
+	}
+	return c
+}
+
+func (d *SignalDataJSON) clone() *SignalDataJSON {
+	c := &SignalDataJSON{
+		Timestamp: d.Timestamp,
+		Messages:  make(map[string]*SignalMessage, len(d.Messages)),
+	}
+	for name, msg := range d.Messages {
+		m := *msg
+		m.Signals = make(map[string]SignalValue, len(msg.Signals))
+		for sig, value := range msg.Signals {
+			m.Signals[sig] = value
+		}
+		c.Messages[name] = &m
+	}
+	return c
+}
+
+func (d *CellMapJSON) clone() *CellMapJSON {
+	c := *d
+	c.Cells = make([]CellVoltage, len(d.Cells))
+	copy(c.Cells, d.Cells)
+	return &c
+}
+
+func (d *ThermistorMapJSON) clone() *ThermistorMapJSON {
+	c := *d
+	c.Thermistors = make([]ThermistorReading, len(d.Thermistors))
+	copy(c.Thermistors, d.Thermistors)
+	return &c
+}
+
+func (d *InverterDataJSON) clone() *InverterDataJSON {
+	c := *d
+	return &c
+}
+
+func (d *AlertDataJSON) clone() *AlertDataJSON {
+	c := *d
+	c.Alerts = make([]AlertEntry, len(d.Alerts))
+	copy(c.Alerts, d.Alerts)
+	c.MessageCount = make(map[string]int, len(d.MessageCount))
+	for name, count := range d.MessageCount {
+		c.MessageCount[name] = count
+	}
+	return &c
+}
+
+func (d *FreshnessJSON) clone() *FreshnessJSON {
+	c := *d
+	c.Messages = make([]MessageFreshness, len(d.Messages))
+	copy(c.Messages, d.Messages)
+	c.Nodes = make(map[string]NodeFreshness, len(d.Nodes))
+	for node, state := range d.Nodes {
+		c.Nodes[node] = state
+	}
+	return &c
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotCopyOnWrite(t *testing.T) {
+	store := newStateStore(nil)
+	store.Update(func(st *telemetryState) {
+		st.CellData.PackData.SOC = 500
+		st.CellData.Status["pack_data"] = stateLive
+		st.touch(docEVData)
+		st.SignalData.Messages["BmsLimits"] = &SignalMessage{ID: "351", Signals: map[string]SignalValue{"ChargeVoltageLimit": {Value: 420}}}
+		st.touch(docSignals)
+	})
+	first := store.Snapshot()
+	if again := store.Snapshot(); again != first {
+		t.Error("Snapshot without changes returned a new snapshot")
+	}
+
+	// Only ev_data changes: signals.json is shared, ev_data.json copied
+	store.Update(func(st *telemetryState) {
+		st.CellData.PackData.SOC = 400
+		st.CellData.Status["pack_data"] = stateStale
+		st.touch(docEVData)
+	})
+	second := store.Snapshot()
+	if second.Version <= first.Version {
+		t.Errorf("version %d after a change, was %d", second.Version, first.Version)
+	}
+	if second.SignalData != first.SignalData || second.InvData != first.InvData {
+		t.Error("unchanged documents were copied")
+	}
+	if second.CellData == first.CellData {
+		t.Fatal("changed document shared with the previous snapshot")
+	}
+	if second.CellData.PackData.SOC != 400 || second.CellData.Status["pack_data"] != stateStale {
+		t.Errorf("second snapshot ev_data = %v %v", second.CellData.PackData.SOC, second.CellData.Status)
+	}
+
+	// Later updates do not reach snapshots already taken, including nested maps
+	store.Update(func(st *telemetryState) {
+		st.CellData.PackData.SOC = 300
+		st.CellData.Status["pack_data"] = stateTimeout
+		st.touch(docEVData)
+		st.SignalData.Messages["BmsLimits"].Signals["ChargeVoltageLimit"] = SignalValue{Value: 410}
+		st.SignalData.Messages["BmsLimits"].Count++
+		st.touch(docSignals)
+	})
+	if first.CellData.PackData.SOC != 500 || first.CellData.Status["pack_data"] != stateLive {
+		t.Errorf("first snapshot ev_data changed to %v %v", first.CellData.PackData.SOC, first.CellData.Status)
+	}
+	if second.CellData.PackData.SOC != 400 || second.CellData.Status["pack_data"] != stateStale {
+		t.Errorf("second snapshot ev_data changed to %v %v", second.CellData.PackData.SOC, second.CellData.Status)
+	}
+	limits := second.SignalData.Messages["BmsLimits"]
+	if limits.Signals["ChargeVoltageLimit"].Value != 420 || limits.Count != 0 {
+		t.Errorf("second snapshot signals changed to %+v", limits)
+	}
+	if got := store.Snapshot().SignalData.Messages["BmsLimits"].Signals["ChargeVoltageLimit"].Value; got != 410 {
+		t.Errorf("new snapshot ChargeVoltageLimit = %v, want 410", got)
+	}
+}
+
+func TestFileSinkWritesUnchangedDocuments(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // the sink still writes at startup and on shutdown
+	runFileSink(ctx, newStateStore(nil), dir, time.Hour)
+
+	for _, name := range dataFiles {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s not written: %v", name, err)
+		}
+	}
+}
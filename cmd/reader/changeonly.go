@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/canframe"
+	"github.com/spf13/viper"
+)
+
+// changeOnlyConfig holds the reader.change_only settings.
+type changeOnlyConfig struct {
+	Enabled   bool
+	Heartbeat time.Duration
+}
+
+// loadChangeOnlyConfig reads reader.change_only from the viper configuration.
+func loadChangeOnlyConfig() (changeOnlyConfig, error) {
+	viper.SetDefault("reader.change_only.enabled", false)
+	viper.SetDefault("reader.change_only.heartbeat", time.Second)
+
+	cfg := changeOnlyConfig{
+		Enabled:   viper.GetBool("reader.change_only.enabled"),
+		Heartbeat: viper.GetDuration("reader.change_only.heartbeat"),
+	}
+	if cfg.Enabled && cfg.Heartbeat <= 0 {
+		return cfg, fmt.Errorf("reader.change_only.heartbeat must be positive, got %v", cfg.Heartbeat)
+	}
+	return cfg, nil
+}
+
+// changeKey identifies a message within a channel.
+type changeKey struct {
+	channel string
+	id      string
+	kind    string
+}
+
+// publishedFrame is the last frame of a message that was published.
+type publishedFrame struct {
+	length int
+	data   string
+	at     time.Time
+}
+
+// changeFilter decides which frames are published in change-only mode: a frame
+// goes out when its payload differs from the last one published for the same
+// channel and ID, or when heartbeat has passed since. Error and remote frames
+// always go out. It is used from the reader's main loop only.
+type changeFilter struct {
+	heartbeat time.Duration
+	last      map[changeKey]publishedFrame
+}
+
+func newChangeFilter(heartbeat time.Duration) *changeFilter {
+	return &changeFilter{heartbeat: heartbeat, last: make(map[changeKey]publishedFrame)}
+}
+
+// Pass reports whether the frame is to be published and remembers it if so.
+func (c *changeFilter) Pass(f *canframe.Frame) bool {
+	if f.Error || f.RTR {
+		return true
+	}
+	at := f.Time()
+	if at.IsZero() {
+		at = time.Now()
+	}
+	key := changeKey{channel: f.Channel, id: f.ID, kind: f.Kind()}
+	last, seen := c.last[key]
+	if seen && last.length == f.Length && last.data == string(f.Data) && at.Sub(last.at) < c.heartbeat {
+		return false
+	}
+	c.last[key] = publishedFrame{length: f.Length, data: string(f.Data), at: at}
+	return true
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/canframe"
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/cansock"
+	"github.com/spf13/viper"
+)
+
+// channelNamePattern keeps channel names usable as a NATS subject token and in file names.
+var channelNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// defaultBitrate is the nominal bitrate assumed for bus-load statistics when a
+// channel does not set one.
+const defaultBitrate = 500000
+
+// Channel backends.
+const (
+	backendSocketCAN = "socketcan"
+	backendSlcan     = "slcan"
+)
+
+// channelConfig is one entry of reader.channels. A SocketCAN channel reads
+// Interface; an slcan channel talks to the serial adapter on Device, opened at
+// Bitrate. Otherwise the bitrates are only used for the bus-load statistics;
+// DataBitrate is the CAN FD data phase and defaults to Bitrate.
+type channelConfig struct {
+	Name        string `mapstructure:"name"`
+	Backend     string `mapstructure:"backend"`
+	Interface   string `mapstructure:"interface"`
+	Device      string `mapstructure:"device"`
+	Baud        int    `mapstructure:"baud"`
+	ListenOnly  bool   `mapstructure:"listen_only"`
+	Bitrate     int    `mapstructure:"bitrate"`
+	DataBitrate int    `mapstructure:"data_bitrate"`
+}
+
+// source names what the channel reads, for log messages and health events.
+func (ch channelConfig) source() string {
+	if ch.Backend == backendSlcan {
+		return ch.Device
+	}
+	return ch.Interface
+}
+
+// loadChannels reads reader.channels. Without the setting the reader listens on
+// can0 only, as it always did.
+func loadChannels() ([]channelConfig, error) {
+	var channels []channelConfig
+	if err := viper.UnmarshalKey("reader.channels", &channels); err != nil {
+		return nil, fmt.Errorf("reader.channels: %w", err)
+	}
+	if len(channels) == 0 {
+		channels = []channelConfig{{Name: "can0", Backend: backendSocketCAN, Interface: "can0"}}
+	}
+
+	seen := make(map[string]bool, len(channels))
+	for i := range channels {
+		ch := &channels[i]
+		switch ch.Backend {
+		case "", backendSocketCAN:
+			ch.Backend = backendSocketCAN
+			if ch.Interface == "" {
+				return nil, fmt.Errorf("reader.channels[%d]: interface is required", i)
+			}
+		case backendSlcan:
+			if ch.Device == "" {
+				return nil, fmt.Errorf("reader.channels[%d]: device is required for slcan", i)
+			}
+		default:
+			return nil, fmt.Errorf("reader.channels[%d]: unknown backend %q", i, ch.Backend)
+		}
+		if ch.Name == "" {
+			ch.Name = ch.Interface
+			if ch.Backend == backendSlcan {
+				ch.Name = "slcan" + strconv.Itoa(i)
+			}
+		}
+		if !channelNamePattern.MatchString(ch.Name) {
+			return nil, fmt.Errorf("reader.channels[%d]: invalid channel name %q", i, ch.Name)
+		}
+		if seen[ch.Name] {
+			return nil, fmt.Errorf("reader.channels: duplicate channel name %q", ch.Name)
+		}
+		seen[ch.Name] = true
+		if ch.Bitrate < 0 || ch.DataBitrate < 0 {
+			return nil, fmt.Errorf("reader.channels[%d]: bitrate must be positive", i)
+		}
+		if ch.Bitrate == 0 {
+			ch.Bitrate = defaultBitrate
+		}
+		if ch.DataBitrate == 0 {
+			ch.DataBitrate = ch.Bitrate
+		}
+		if ch.Baud == 0 {
+			ch.Baud = 115200
+		}
+	}
+	return channels, nil
+}
+
+// filterConfig is one entry of reader.filters.publish or reader.filters.log.
+// IDs and masks are hex strings; the mask defaults to all identifier bits.
+type filterConfig struct {
+	ID       string `mapstructure:"id"`
+	Mask     string `mapstructure:"mask"`
+	Extended bool   `mapstructure:"extended"`
+}
+
+// frameFilters select the frames that are published and the frames that are
+// written to the capture file. An empty list selects every frame. With All set
+// the frames neither list selects are still read, for the bus statistics.
+type frameFilters struct {
+	Publish []cansock.Filter
+	Log     []cansock.Filter
+	All     bool
+}
+
+// loadFilters reads reader.filters.
+func loadFilters() (frameFilters, error) {
+	var filters frameFilters
+	var err error
+	if filters.Publish, err = loadFilterList("reader.filters.publish"); err != nil {
+		return filters, err
+	}
+	if filters.Log, err = loadFilterList("reader.filters.log"); err != nil {
+		return filters, err
+	}
+	return filters, nil
+}
+
+func loadFilterList(key string) ([]cansock.Filter, error) {
+	var entries []filterConfig
+	if err := viper.UnmarshalKey(key, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	filters := make([]cansock.Filter, 0, len(entries))
+	for i, entry := range entries {
+		id, err := canframe.ParseID(entry.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%s[%d]: %w", key, i, err)
+		}
+		filter := cansock.Filter{ID: id, Extended: entry.Extended || id > canframe.MaxStandardID}
+		maxID := uint32(canframe.MaxStandardID)
+		if filter.Extended {
+			maxID = canframe.MaxExtendedID
+		}
+		if id > maxID {
+			return nil, fmt.Errorf("%s[%d]: CAN ID %s out of range", key, i, entry.ID)
+		}
+		filter.Mask = maxID
+		if entry.Mask != "" {
+			if filter.Mask, err = canframe.ParseID(entry.Mask); err != nil {
+				return nil, fmt.Errorf("%s[%d]: mask: %w", key, i, err)
+			}
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// kernel returns the filters to install on the socket: every frame either set
+// wants. Nil, receiving everything, when one of the sets is empty or All is set.
+func (f frameFilters) kernel() []cansock.Filter {
+	if f.All || len(f.Publish) == 0 || len(f.Log) == 0 {
+		return nil
+	}
+	return append(append([]cansock.Filter(nil), f.Publish...), f.Log...)
+}
+
+// channelFrame is a frame on its way from a channel to the publisher and the
+// capture file.
+type channelFrame struct {
+	canframe.Frame
+	Publish bool
+	Log     bool
+}
+
+// channelLogPath derives the per-channel log file from logs.canbus_json, e.g.
+// logs/canbus.json becomes logs/canbus_can1.json.
+func channelLogPath(path, channel string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "_" + channel + ext
+}
+
+// frameLog writes frames to the combined log file or to one file per channel.
+// Writes are buffered; Close flushes them.
+type frameLog struct {
+	files    []*os.File
+	buffers  []*bufio.Writer
+	combined *json.Encoder
+	channels map[string]*json.Encoder
+}
+
+// add opens a log file and returns the encoder writing to it.
+func (fl *frameLog) add(path string) (*json.Encoder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriterSize(file, 64*1024)
+	fl.files = append(fl.files, file)
+	fl.buffers = append(fl.buffers, buf)
+	return json.NewEncoder(buf), nil
+}
+
+func openFrameLog(path string, channels []channelConfig, perChannel bool) (*frameLog, error) {
+	fl := &frameLog{}
+	if !perChannel {
+		enc, err := fl.add(path)
+		if err != nil {
+			return nil, err
+		}
+		fl.combined = enc
+		return fl, nil
+	}
+
+	fl.channels = make(map[string]*json.Encoder, len(channels))
+	for _, ch := range channels {
+		enc, err := fl.add(channelLogPath(path, ch.Name))
+		if err != nil {
+			fl.Close()
+			return nil, err
+		}
+		fl.channels[ch.Name] = enc
+	}
+	return fl, nil
+}
+
+// Write appends a frame to its log file.
+func (fl *frameLog) Write(frame *canframe.Frame) error {
+	enc := fl.combined
+	if enc == nil {
+		enc = fl.channels[frame.Channel]
+	}
+	if enc == nil {
+		return fmt.Errorf("no log file for channel %q", frame.Channel)
+	}
+	return enc.Encode(frame)
+}
+
+// Close flushes the buffered frames and closes the files.
+func (fl *frameLog) Close() error {
+	var errs []error
+	for i, file := range fl.files {
+		errs = append(errs, fl.buffers[i].Flush(), file.Sync(), file.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// read reads frames from the channel's socket until it fails or the controller
+// goes bus-off, and sends them, tagged with the channel name and whether the
+// filters select them for publishing and logging, to out. Meta is the delta to
+// the previous frame of the same channel, filtered or not by the kernel.
+func (m *channelMonitor) read(conn frameConn, out chan<- channelFrame) error {
+	ch := m.ch
+	var lastFrameTime time.Time
+	timeSource := cansock.TimeHost
+	for {
+		frame, err := conn.ReadFrame()
+		if err != nil {
+			return err
+		}
+		if frame.TimeSource != timeSource {
+			timeSource = frame.TimeSource
+			log.Printf("Channel %s: frame timestamps taken from %s clock", ch.Name, timeSource)
+		}
+
+		var deltaMs int64
+		if lastFrameTime.IsZero() {
+			deltaMs = 0 // First frame
+		} else {
+			deltaMs = frame.Time.Sub(lastFrameTime).Milliseconds()
+		}
+		lastFrameTime = frame.Time
+
+		payload := frame.Payload()
+		wrapped := canframe.Frame{
+			ID:        canframe.FormatID(frame.ID, frame.Extended || frame.Error),
+			Length:    len(payload),
+			Data:      payload,
+			Meta:      deltaMs,
+			Timestamp: frame.Time.UnixNano(),
+			Channel:   ch.Name,
+			Extended:  frame.Extended,
+			RTR:       frame.RTR,
+			Error:     frame.Error,
+			FD:        frame.FD,
+			BRS:       frame.BRS,
+			ESI:       frame.ESI,
+		}
+		if frame.RTR {
+			// The DLC of a remote frame is the requested length, there is no payload
+			wrapped.Length = int(frame.Length)
+		}
+		cf := channelFrame{
+			Frame:   wrapped,
+			Publish: cansock.MatchAny(m.filters.Publish, &frame),
+			Log:     cansock.MatchAny(m.filters.Log, &frame),
+		}
+		// Frames neither set wants are only passed on for the bus statistics;
+		// adapters without kernel filters deliver them too
+		if cf.Publish || cf.Log || m.filters.All {
+			out <- cf
+		}
+
+		if frame.Error && m.observeErrorFrame(&frame) {
+			return errBusOff
+		}
+	}
+}
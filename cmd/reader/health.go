@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/cansock"
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/slcan"
+	"github.com/spf13/viper"
+)
+
+// Bus-health events besides the bus state names (error_active, error_warning,
+// error_passive, bus_off, stopped).
+const (
+	eventReadError     = "read_error"
+	eventRestarting    = "restarting"
+	eventRestarted     = "restarted"
+	eventRestartFailed = "restart_failed"
+)
+
+// errBusOff ends a read loop when an error frame reports bus-off.
+var errBusOff = errors.New("controller is bus-off")
+
+// busEvent is published on <reader.health_subject_prefix>.<channel> and written
+// to the service log.
+type busEvent struct {
+	Channel   string `json:"channel"`
+	Interface string `json:"interface"`
+	Event     string `json:"event"`
+	State     string `json:"state"`
+	TxErrors  uint16 `json:"tx_errors"`
+	RxErrors  uint16 `json:"rx_errors"`
+	Restarts  int    `json:"restarts"` // interface restarts by this reader
+	Error     string `json:"error,omitempty"`
+	Timestamp string `json:"timestamp"`
+}
+
+// recoveryConfig holds the reader.recovery settings.
+type recoveryConfig struct {
+	PollInterval     time.Duration
+	MinBackoff       time.Duration
+	MaxBackoff       time.Duration
+	RestartInterface bool
+}
+
+// loadRecoveryConfig reads reader.recovery from the viper configuration.
+func loadRecoveryConfig() (recoveryConfig, error) {
+	viper.SetDefault("reader.recovery.poll_interval", time.Second)
+	viper.SetDefault("reader.recovery.min_backoff", time.Second)
+	viper.SetDefault("reader.recovery.max_backoff", 30*time.Second)
+	viper.SetDefault("reader.recovery.restart_interface", true)
+
+	cfg := recoveryConfig{
+		PollInterval:     viper.GetDuration("reader.recovery.poll_interval"),
+		MinBackoff:       viper.GetDuration("reader.recovery.min_backoff"),
+		MaxBackoff:       viper.GetDuration("reader.recovery.max_backoff"),
+		RestartInterface: viper.GetBool("reader.recovery.restart_interface"),
+	}
+	if cfg.PollInterval <= 0 {
+		return cfg, fmt.Errorf("reader.recovery.poll_interval must be positive, got %v", cfg.PollInterval)
+	}
+	if cfg.MinBackoff <= 0 || cfg.MaxBackoff < cfg.MinBackoff {
+		return cfg, fmt.Errorf("reader.recovery backoff must satisfy 0 < min_backoff <= max_backoff, got %v and %v", cfg.MinBackoff, cfg.MaxBackoff)
+	}
+	return cfg, nil
+}
+
+// channelMonitor owns the socket of one channel. It follows the bus state from
+// error frames and netlink, and reopens the socket (cycling the interface) with
+// exponential backoff when the bus goes off or the read fails.
+type channelMonitor struct {
+	ch      channelConfig
+	cfg     recoveryConfig
+	filters frameFilters
+	events  chan<- busEvent
+
+	mu       sync.Mutex
+	conn     frameConn
+	state    cansock.BusState
+	txErrors uint16
+	rxErrors uint16
+	restarts int
+}
+
+func newChannelMonitor(ch channelConfig, cfg recoveryConfig, filters frameFilters, events chan<- busEvent) *channelMonitor {
+	return &channelMonitor{ch: ch, cfg: cfg, filters: filters, events: events, state: cansock.StateErrorActive}
+}
+
+// run reads the channel until ctx is done, sending frames to out. It returns
+// once the socket is closed and the state poller has stopped.
+func (m *channelMonitor) run(ctx context.Context, out chan<- channelFrame) {
+	// Serial adapters have no netlink state to poll
+	var poller sync.WaitGroup
+	if m.ch.Backend == backendSocketCAN {
+		poller.Add(1)
+		go func() {
+			defer poller.Done()
+			m.poll(ctx)
+		}()
+	}
+	defer poller.Wait()
+
+	// Closing the socket ends a blocked read
+	stop := context.AfterFunc(ctx, func() { m.closeConn() })
+	defer stop()
+
+	backoff := m.cfg.MinBackoff
+	for {
+		conn, err := m.dial()
+		if err == nil {
+			m.setConn(conn)
+			if ctx.Err() != nil {
+				conn.Close() // cancelled before the socket was registered
+			}
+			started := time.Now()
+			err = m.read(conn, out)
+			m.setConn(nil)
+			conn.Close()
+
+			// A channel that ran for a while starts over with the shortest wait
+			if time.Since(started) > m.cfg.MaxBackoff {
+				backoff = m.cfg.MinBackoff
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		// Bus-off and a downed interface were already reported as state changes
+		if !errors.Is(err, errBusOff) && !m.faulted() {
+			m.emit(eventReadError, err)
+		}
+
+		if m.cfg.RestartInterface && m.ch.Backend == backendSocketCAN {
+			m.restart()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, m.cfg.MaxBackoff)
+	}
+}
+
+// frameConn is an open channel: a SocketCAN socket or an slcan adapter.
+type frameConn interface {
+	ReadFrame() (cansock.Frame, error)
+	Close() error
+}
+
+// dial opens the channel with its backend. An slcan adapter is set up afresh
+// on every open, which also recovers it after a bus error.
+func (m *channelMonitor) dial() (frameConn, error) {
+	if m.ch.Backend == backendSlcan {
+		opts := []slcan.Option{slcan.WithBaudRate(m.ch.Baud), slcan.WithBitrate(m.ch.Bitrate)}
+		if m.ch.ListenOnly {
+			opts = append(opts, slcan.WithListenOnly())
+		}
+		return slcan.Open(m.ch.Device, opts...)
+	}
+	return cansock.Dial(m.ch.Interface, cansock.WithFilters(m.filters.kernel()...))
+}
+
+// restart cycles the interface down and up to bring the controller out of bus-off.
+func (m *channelMonitor) restart() {
+	m.emit(eventRestarting, nil)
+	err := cansock.SetLinkUp(m.ch.Interface, false)
+	if err == nil {
+		err = cansock.SetLinkUp(m.ch.Interface, true)
+	}
+	if err != nil {
+		m.emit(eventRestartFailed, err)
+		return
+	}
+	m.mu.Lock()
+	m.restarts++
+	m.mu.Unlock()
+	m.emit(eventRestarted, nil)
+}
+
+// poll reads the bus state and error counters over netlink until ctx is done.
+// Bus-off, or the interface going down, closes the socket so run recovers it.
+func (m *channelMonitor) poll(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		status, err := cansock.GetLinkStatus(m.ch.Interface)
+		if err != nil {
+			continue // the interface may be gone while a USB adapter reconnects
+		}
+		m.update(status.State, status.TxErrors, status.RxErrors, true)
+
+		if status.State == cansock.StateBusOff || status.State == cansock.StateStopped {
+			m.closeConn()
+		}
+	}
+}
+
+// observeErrorFrame updates the bus state from an error frame and reports
+// whether the controller went bus-off.
+func (m *channelMonitor) observeErrorFrame(frame *cansock.Frame) bool {
+	m.mu.Lock()
+	tx, rx := m.txErrors, m.rxErrors
+	m.mu.Unlock()
+	if ftx, frx, ok := cansock.ErrorFrameCounters(frame); ok {
+		tx, rx = ftx, frx
+	}
+	state, ok := cansock.ErrorFrameState(frame)
+	m.update(state, tx, rx, ok)
+	return ok && state == cansock.StateBusOff
+}
+
+// update records the counters and, when haveState is set, the bus state. A
+// state change is published.
+func (m *channelMonitor) update(state cansock.BusState, tx, rx uint16, haveState bool) {
+	m.mu.Lock()
+	m.txErrors, m.rxErrors = tx, rx
+	changed := haveState && state != m.state
+	if changed {
+		m.state = state
+	}
+	m.mu.Unlock()
+	if changed {
+		m.emit(state.String(), nil)
+	}
+}
+
+// faulted reports whether the last known state needs the interface restarted.
+func (m *channelMonitor) faulted() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state == cansock.StateBusOff || m.state == cansock.StateStopped
+}
+
+func (m *channelMonitor) setConn(conn frameConn) {
+	m.mu.Lock()
+	m.conn = conn
+	m.mu.Unlock()
+}
+
+// closeConn closes the current socket, if any, which ends its read loop.
+func (m *channelMonitor) closeConn() {
+	m.mu.Lock()
+	if m.conn != nil {
+		m.conn.Close()
+	}
+	m.mu.Unlock()
+}
+
+func (m *channelMonitor) emit(event string, err error) {
+	m.mu.Lock()
+	ev := busEvent{
+		Channel:   m.ch.Name,
+		Interface: m.ch.source(),
+		Event:     event,
+		State:     m.state.String(),
+		TxErrors:  m.txErrors,
+		RxErrors:  m.rxErrors,
+		Restarts:  m.restarts,
+		Timestamp: time.Now().Format(time.RFC3339Nano),
+	}
+	m.mu.Unlock()
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	m.events <- ev
+}
+
+// logBusEvent writes a bus-health event to the service log.
+func logBusEvent(ev busEvent) {
+	msg := fmt.Sprintf("Channel %s (%s): %s, state %s, TX errors %d, RX errors %d, restarts %d",
+		ev.Channel, ev.Interface, ev.Event, ev.State, ev.TxErrors, ev.RxErrors, ev.Restarts)
+	if ev.Error != "" {
+		msg += ": " + ev.Error
+	}
+	log.Print(msg)
+}
@@ -1,29 +1,30 @@
 package main
 
-// This program listens on the CAN interface (can0), publishes all CAN frames to a NATS subject (can.raw),
-// and optionally logs them in JSON format to a file specified via -l flag. The service log only records start and stop times.
+// This program listens on the CAN interfaces listed in reader.channels (default can0), publishes all CAN frames
+// tagged with their channel to NATS (can.raw.<channel>.<id>, or can.raw.<channel> and can.raw per reader.subjects),
+// and optionally logs them in JSON format to a file specified via -l flag. Each interface is monitored for error
+// states and bus-off and restarted with backoff. Bus-health events go to can.health.<channel>; the service log only
+// records the start and stop times and those events. Bus load and per-ID rates are published on can.stats every
+// second. With reader.change_only a frame is published only when its payload changes or as a heartbeat, while
+// the capture file still records every frame. SIGINT and SIGTERM stop the reader once the frames already read are published and the capture file is flushed.
 
 import (
 	"context"
 	"encoding/json"
 	"flag"
-	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/canframe"
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/natsconf"
 	"github.com/nats-io/nats.go"
 	"github.com/spf13/viper"
-	"go.einride.tech/can/pkg/socketcan"
 )
 
-type CANFrame struct {
-	ID     string `json:"id"`
-	Length int    `json:"length"`
-	Data   string `json:"data"`
-	Meta   int64  `json:"meta"`
-}
-
 func main() {
 	// Command-line flag for canbus logging
 	enableLogging := flag.Bool("l", false, "Enable logging of CAN messages to canbus.json file")
@@ -40,6 +41,65 @@ func main() {
 
 	serviceLogPath := viper.GetString("logs.service_log")
 	canbusJSONPath := viper.GetString("logs.canbus_json")
+	perChannelLogs := viper.GetBool("logs.per_channel")
+
+	viper.SetDefault("reader.health_subject_prefix", "can.health")
+	healthPrefix := viper.GetString("reader.health_subject_prefix")
+
+	viper.SetDefault("reader.spool.dir", "logs/spool")
+	viper.SetDefault("reader.spool.max_bytes", "64MB")
+	viper.SetDefault("reader.spool.segment_bytes", "4MB")
+	viper.SetDefault("reader.spool.stats_interval", 10*time.Second)
+	viper.SetDefault("reader.spool.stats_subject", "can.spool")
+	spoolDir := viper.GetString("reader.spool.dir")
+	spoolMaxBytes := int64(viper.GetSizeInBytes("reader.spool.max_bytes"))
+	spoolSegmentBytes := int64(viper.GetSizeInBytes("reader.spool.segment_bytes"))
+	spoolStatsInterval := viper.GetDuration("reader.spool.stats_interval")
+	spoolStatsSubject := viper.GetString("reader.spool.stats_subject")
+	if spoolStatsInterval <= 0 {
+		log.Fatalf("reader.spool.stats_interval must be positive, got %v", spoolStatsInterval)
+	}
+
+	channels, err := loadChannels()
+	if err != nil {
+		log.Fatalf("Invalid reader config: %v", err)
+	}
+	recoveryCfg, err := loadRecoveryConfig()
+	if err != nil {
+		log.Fatalf("Invalid reader config: %v", err)
+	}
+	filters, err := loadFilters()
+	if err != nil {
+		log.Fatalf("Invalid reader config: %v", err)
+	}
+	subjectLayout, err := natsconf.LoadSubjectLayout()
+	if err != nil {
+		log.Fatalf("Invalid reader config: %v", err)
+	}
+	viper.SetDefault("reader.encoding", canframe.EncodingBinary)
+	contentType, err := canframe.ContentType(viper.GetString("reader.encoding"))
+	if err != nil {
+		log.Fatalf("Invalid reader config: reader.encoding: %v", err)
+	}
+	statsCfg, err := loadStatsConfig()
+	if err != nil {
+		log.Fatalf("Invalid reader config: %v", err)
+	}
+	// To count every frame on the bus the filters are applied here instead of
+	// in the kernel
+	filters.All = statsCfg.Subject != "" && statsCfg.AllFrames
+	changeOnlyCfg, err := loadChangeOnlyConfig()
+	if err != nil {
+		log.Fatalf("Invalid reader config: %v", err)
+	}
+	natsCfg, err := natsconf.Load("reader")
+	if err != nil {
+		log.Fatalf("Invalid NATS config: %v", err)
+	}
+	streamCfg, err := natsconf.LoadStream(natsconf.RawSubject, natsconf.RawSubject+".>")
+	if err != nil {
+		log.Fatalf("Invalid NATS config: %v", err)
+	}
 
 	// Setup service logger (append mode, keep between runs)
 	serviceLogFile, err := os.OpenFile(serviceLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
@@ -52,85 +112,162 @@ func main() {
 	// Record start time
 	log.Printf("Reader service started at %s", time.Now().Format(time.RFC3339))
 
-	nc, err := nats.Connect(nats.DefaultURL)
+	// SIGINT and SIGTERM (systemctl stop) start an ordered shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Frames are spooled to disk while NATS is unreachable, including at startup
+	sp, err := openSpool(spoolDir, spoolMaxBytes, spoolSegmentBytes)
+	if err != nil {
+		log.Fatalf("Failed to open spool: %v", err)
+	}
+	wake := make(chan struct{}, 1)
+	// The reader always keeps retrying, whatever the reconnect policy, since the spool covers the outage
+	nc, err := natsCfg.Connect(
+		nats.RetryOnFailedConnect(true),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			log.Printf("Disconnected from NATS, spooling frames to %s: %v", spoolDir, err)
+		}),
+		nats.ConnectHandler(func(nc *nats.Conn) {
+			log.Printf("Connected to NATS at %s", nc.ConnectedUrlRedacted())
+			wakeReplay(wake)
+		}),
+		nats.ReconnectHandler(func(_ *nats.Conn) {
+			log.Printf("Reconnected to NATS, replaying %d spooled frames", sp.Stats().Pending)
+			wakeReplay(wake)
+		}),
+	)
 	if err != nil {
 		log.Fatalf("Error connecting to NATS: %v", err)
 	}
-	defer nc.Close()
 
-	// Setup JetStream with max age of 60 seconds
-	js, err := nc.JetStream()
+	// JetStream stream (nats.stream, 60 seconds by default), created once NATS is reachable
+	publisher, err := newSpooledPublisher(nc, streamCfg, sp, spoolStatsSubject, wake)
 	if err != nil {
-		log.Fatalf("Error initializing JetStream: %v", err)
+		log.Fatalf("%v", err)
 	}
+	publisherDone := make(chan struct{})
+	go func() {
+		defer close(publisherDone)
+		publisher.run(ctx, spoolStatsInterval)
+	}()
 
-	_, err = js.AddStream(&nats.StreamConfig{
-		Name:     "CAN",
-		Subjects: []string{"can.raw"},
-		MaxAge:   60 * time.Second,
-	})
-	if err != nil {
-		log.Fatalf("Error creating JetStream stream: %v", err)
+	for _, ch := range channels {
+		log.Printf("Channel %s: reading %s (%s), publishing on %s", ch.Name, ch.source(), ch.Backend,
+			natsconf.FrameSubject(subjectLayout, &canframe.Frame{Channel: ch.Name, ID: "<id>"}))
+	}
+	if kernel := filters.kernel(); len(kernel) > 0 {
+		log.Printf("Kernel CAN filters: %d (publish %d, log %d)", len(kernel), len(filters.Publish), len(filters.Log))
+	} else if filters.All && (len(filters.Publish) > 0 || len(filters.Log) > 0) {
+		log.Printf("CAN filters applied in the reader so %s counts every frame (publish %d, log %d)", statsCfg.Subject, len(filters.Publish), len(filters.Log))
 	}
 
-	// Open CAN interface
-	conn, err := socketcan.DialContext(context.Background(), "can", "can0")
-	if err != nil {
-		log.Fatalf("Failed to open CAN interface: %v", err)
+	// In change-only mode repeated payloads are published only as a heartbeat
+	var changes *changeFilter
+	if changeOnlyCfg.Enabled {
+		changes = newChangeFilter(changeOnlyCfg.Heartbeat)
+		log.Printf("Change-only publishing, heartbeat every %v", changeOnlyCfg.Heartbeat)
 	}
-	defer conn.Close()
-	receiver := socketcan.NewReceiver(conn)
 
-	// Setup canbus JSON file (only if logging enabled)
-	var canbusEncoder *json.Encoder
+	// Setup canbus JSON file(s) (only if logging enabled)
+	var frameLogger *frameLog
 	if *enableLogging {
-		canbusJSONFile, err := os.Create(canbusJSONPath)
+		frameLogger, err = openFrameLog(canbusJSONPath, channels, perChannelLogs)
 		if err != nil {
 			log.Fatalf("Failed to create canbus JSON file: %v", err)
 		}
-		defer canbusJSONFile.Close()
-		canbusEncoder = json.NewEncoder(canbusJSONFile)
-	}
-
-       // Track time of last frame
-       var lastFrameTime time.Time
-       for receiver.Receive() {
-	       frame := receiver.Frame()
-
-	       now := time.Now()
-	       var deltaMs int64
-	       if lastFrameTime.IsZero() {
-		       deltaMs = 0 // First frame
-	       } else {
-		       deltaMs = now.Sub(lastFrameTime).Milliseconds()
-	       }
-	       lastFrameTime = now
-
-	       wrapped := CANFrame{
-		       ID:     fmt.Sprintf("%X", frame.ID),
-		       Length: len(frame.Data[:frame.Length]),
-		       Data:   fmt.Sprintf("%X", frame.Data[:frame.Length]),
-		       Meta:   deltaMs,
-	       }
-
-	       encoded, err := json.Marshal(wrapped)
-	       if err != nil {
-		       continue
-	       }
-
-	       // Publish to NATS JetStream
-	       _, _ = js.Publish("can.raw", encoded)
-
-	       // Write to canbus JSON file if logging enabled
-	       if canbusEncoder != nil {
-		       _ = canbusEncoder.Encode(wrapped)
-	       }
-       }
-
-	// On exit, record stop time
-	if err := receiver.Err(); err != nil {
-		log.Printf("Reader service stopped with error at %s: %v", time.Now().Format(time.RFC3339), err)
-	} else {
-		log.Printf("Reader service stopped cleanly at %s", time.Now().Format(time.RFC3339))
 	}
+
+	// Every channel is read concurrently by its monitor, which reopens the socket
+	// after bus-off or read errors. Frames are published and logged here so the
+	// combined log file has a single writer. frames is closed once every monitor
+	// has stopped after a shutdown signal.
+	frames := make(chan channelFrame, 256)
+	events := make(chan busEvent, 16)
+	var monitors sync.WaitGroup
+	for _, ch := range channels {
+		monitors.Add(1)
+		go func() {
+			defer monitors.Done()
+			newChannelMonitor(ch, recoveryCfg, filters, events).run(ctx, frames)
+		}()
+	}
+	go func() {
+		monitors.Wait()
+		close(frames)
+	}()
+
+	// Live bus statistics of every frame the filters let through, or of every
+	// frame on the bus with reader.stats.all_frames
+	stats := newBusStatsCollector(channels)
+	stats.filtered = !filters.All && len(filters.Publish) > 0 && len(filters.Log) > 0
+	var statsTick <-chan time.Time
+	if statsCfg.Subject != "" {
+		ticker := time.NewTicker(statsCfg.Interval)
+		defer ticker.Stop()
+		statsTick = ticker.C
+	}
+
+	shutdown := ctx.Done()
+loop:
+	for {
+		select {
+		case <-shutdown:
+			log.Printf("Shutting down: closing CAN sockets")
+			shutdown = nil
+		case now := <-statsTick:
+			for _, s := range stats.Snapshot(now) {
+				if encoded, err := json.Marshal(s); err == nil {
+					_ = nc.Publish(statsCfg.Subject, encoded)
+				}
+			}
+		case ev := <-events:
+			logBusEvent(ev)
+			if healthPrefix != "" {
+				if encoded, err := json.Marshal(ev); err == nil {
+					_ = nc.Publish(healthPrefix+"."+ev.Channel, encoded)
+				}
+			}
+		case cf, ok := <-frames:
+			if !ok {
+				break loop
+			}
+			if statsTick != nil {
+				stats.Observe(&cf.Frame)
+			}
+
+			// Publish to NATS JetStream, or spool while it is unreachable
+			if cf.Publish && (changes == nil || changes.Pass(&cf.Frame)) {
+				encoded, err := canframe.Encode(&cf.Frame, contentType)
+				if err != nil {
+					continue
+				}
+				publisher.Publish(natsconf.FrameSubject(subjectLayout, &cf.Frame), contentType, encoded)
+			}
+
+			// Write to canbus JSON file if logging enabled
+			if frameLogger != nil && cf.Log {
+				_ = frameLogger.Write(&cf.Frame)
+			}
+		}
+	}
+
+	// Every frame read has been published, spooled or logged. Stop the spool
+	// replay, then close the files and flush NATS.
+	<-publisherDone
+	if err := sp.Close(); err != nil {
+		log.Printf("Error closing spool: %v", err)
+	}
+	if pending := sp.Stats().Pending; pending > 0 {
+		log.Printf("%d frames left in the spool for the next start", pending)
+	}
+	if frameLogger != nil {
+		if err := frameLogger.Close(); err != nil {
+			log.Printf("Error closing canbus JSON file: %v", err)
+		}
+	}
+	if err := natsconf.Close(nc, 2*time.Second); err != nil {
+		log.Printf("Error flushing NATS: %v", err)
+	}
+	log.Printf("Reader service stopped at %s", time.Now().Format(time.RFC3339))
 }
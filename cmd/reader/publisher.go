@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/canframe"
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/natsconf"
+	"github.com/nats-io/nats.go"
+)
+
+// publishTimeout bounds the wait for a JetStream acknowledgement, so a hanging
+// server sends frames to the spool instead of stalling the bus.
+const publishTimeout = time.Second
+
+// spooledPublisher publishes frames to JetStream and spools them to disk while
+// NATS is unreachable. Spooled frames are replayed in order after reconnecting,
+// and new frames keep going to the spool until it is empty.
+type spooledPublisher struct {
+	nc           *nats.Conn
+	js           nats.JetStreamContext
+	stream       *nats.StreamConfig
+	spool        *spool
+	statsSubject string
+	wake         chan struct{}
+	streamReady  bool
+}
+
+// newSpooledPublisher creates the publisher. wake is shared with the NATS
+// connection handlers, which signal it when the connection comes up.
+func newSpooledPublisher(nc *nats.Conn, stream *nats.StreamConfig, sp *spool, statsSubject string, wake chan struct{}) (*spooledPublisher, error) {
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("error initializing JetStream: %w", err)
+	}
+	return &spooledPublisher{
+		nc:           nc,
+		js:           js,
+		stream:       stream,
+		spool:        sp,
+		statsSubject: statsSubject,
+		wake:         wake,
+	}, nil
+}
+
+// Publish sends a frame encoded as contentType to JetStream, or to the spool
+// when NATS is down or earlier frames are still waiting.
+func (p *spooledPublisher) Publish(subject, contentType string, data []byte) {
+	if p.spool.Empty() && p.nc.IsConnected() {
+		err := p.publish(subject, contentType, data)
+		if err == nil {
+			return
+		}
+		log.Printf("Publishing to %s failed, spooling frames: %v", subject, err)
+	}
+	if err := p.spool.Append(subject, contentType, data); err != nil {
+		return // counted as dropped
+	}
+	wakeReplay(p.wake)
+}
+
+// publish sends one frame to JetStream with its content type in the header.
+func (p *spooledPublisher) publish(subject, contentType string, data []byte) error {
+	msg := nats.NewMsg(subject)
+	msg.Header.Set(canframe.ContentTypeHeader, contentType)
+	msg.Data = data
+	_, err := p.js.PublishMsg(msg, nats.AckWait(publishTimeout))
+	return err
+}
+
+// wakeReplay asks the replay loop to try draining the spool.
+func wakeReplay(wake chan<- struct{}) {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// run replays the spool whenever NATS is connected and publishes the spool
+// counters every statsInterval, until ctx is done. Frames not replayed by then
+// stay in the spool for the next start.
+func (p *spooledPublisher) run(ctx context.Context, statsInterval time.Duration) {
+	retry := time.NewTicker(time.Second)
+	defer retry.Stop()
+	report := time.NewTicker(statsInterval)
+	defer report.Stop()
+
+	var reported spoolStats
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.wake:
+		case <-retry.C:
+		case <-report.C:
+			stats := p.spool.Stats()
+			if stats != reported {
+				reported = stats
+				log.Printf("Spool: %d spooled, %d replayed, %d dropped, %d pending (%d bytes)",
+					stats.Spooled, stats.Replayed, stats.Dropped, stats.Pending, stats.Bytes)
+			}
+			if p.statsSubject != "" && p.nc.IsConnected() {
+				if encoded, err := json.Marshal(stats); err == nil {
+					_ = p.nc.Publish(p.statsSubject, encoded)
+				}
+			}
+			continue
+		}
+
+		if !p.nc.IsConnected() || !p.ensureStream() || p.spool.Empty() {
+			continue
+		}
+		before := p.spool.Stats().Replayed
+		err := p.spool.Drain(func(subject, contentType string, data []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return p.publish(subject, contentType, data)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Replaying spooled frames failed, retrying: %v", err)
+			continue
+		}
+		log.Printf("Replayed %d spooled frames", p.spool.Stats().Replayed-before)
+	}
+}
+
+// ensureStream creates or updates the JetStream stream once the server is reachable.
+func (p *spooledPublisher) ensureStream() bool {
+	if p.streamReady {
+		return true
+	}
+	if err := natsconf.EnsureStream(p.js, p.stream); err != nil {
+		log.Printf("Error creating JetStream stream: %v", err)
+		return false
+	}
+	p.streamReady = true
+	return true
+}
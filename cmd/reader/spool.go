@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/canframe"
+)
+
+// spoolExt is the file extension of spool segments.
+const spoolExt = ".spool"
+
+// spoolStats are the spool counters, published on reader.spool.stats_subject.
+type spoolStats struct {
+	Spooled  uint64 `json:"spooled"`  // frames written to the spool
+	Replayed uint64 `json:"replayed"` // spooled frames published after reconnecting
+	Dropped  uint64 `json:"dropped"`  // frames lost because the spool was full
+	Pending  int    `json:"pending"`  // frames waiting in the spool
+	Bytes    int64  `json:"bytes"`    // spool size on disk
+}
+
+// spoolSegment is one file of the spool. Every line is "<subject> <payload>",
+// where JSON frames are written as they are and binary frames base64 encoded.
+// JSON always starts with '{', which base64 never does.
+type spoolSegment struct {
+	path     string
+	seq      uint64
+	size     int64
+	frames   int
+	offset   int64 // bytes already replayed
+	replayed int   // frames already replayed
+}
+
+// spool is a bounded on-disk FIFO of frames that could not be published. Frames
+// are appended to the newest segment and replayed from the oldest; when the spool
+// is full the oldest segment is dropped. Segments left over from a previous run
+// are replayed as well. Replay is at-least-once: frames of a segment that was
+// partly replayed before a restart are published again.
+type spool struct {
+	dir          string
+	maxBytes     int64
+	segmentBytes int64
+
+	mu       sync.Mutex
+	segments []*spoolSegment // oldest first
+	active   *os.File        // open for append, always the last segment
+	draining *spoolSegment
+	nextSeq  uint64
+	stats    spoolStats
+}
+
+// openSpool opens the spool directory and picks up segments left from a previous run.
+func openSpool(dir string, maxBytes, segmentBytes int64) (*spool, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("spool max_bytes must be positive, got %d", maxBytes)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &spool{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		segmentBytes: min(max(segmentBytes, 1), maxBytes/4+1),
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+spoolExt))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(path), spoolExt), 10, 64)
+		if err != nil {
+			continue // not ours
+		}
+		seg, err := scanSegment(path, seq)
+		if err != nil {
+			return nil, err
+		}
+		s.segments = append(s.segments, seg)
+		s.stats.Bytes += seg.size
+		s.stats.Pending += seg.frames
+		s.nextSeq = max(s.nextSeq, seq+1)
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].seq < s.segments[j].seq })
+	return s, nil
+}
+
+func scanSegment(path string, seq uint64) (*spoolSegment, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	seg := &spoolSegment{path: path, seq: seq}
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		seg.size += int64(len(line))
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			seg.frames++
+		}
+		if err == io.EOF {
+			return seg, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Empty reports whether every spooled frame has been replayed.
+func (s *spool) Empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.segments) == 0
+}
+
+// Stats returns a copy of the counters.
+func (s *spool) Stats() spoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Append adds a frame to the end of the spool, dropping the oldest segment when
+// the spool is full.
+func (s *spool) Append(subject, contentType string, data []byte) error {
+	if contentType == canframe.ContentTypeBinary {
+		data = base64.StdEncoding.AppendEncode(nil, data)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size := int64(len(subject) + 1 + len(data) + 1)
+	for s.stats.Bytes+size > s.maxBytes {
+		if !s.dropOldest() {
+			s.stats.Dropped++
+			return fmt.Errorf("spool full")
+		}
+	}
+
+	last := s.last()
+	if s.active == nil || last.size+size > s.segmentBytes {
+		if err := s.rotate(); err != nil {
+			s.stats.Dropped++
+			return err
+		}
+		last = s.last()
+	}
+
+	var line bytes.Buffer
+	line.Grow(int(size))
+	line.WriteString(subject)
+	line.WriteByte(' ')
+	line.Write(data)
+	line.WriteByte('\n')
+	n, err := s.active.Write(line.Bytes())
+	last.size += int64(n)
+	s.stats.Bytes += int64(n)
+	if err != nil {
+		s.stats.Dropped++
+		return err
+	}
+	last.frames++
+	s.stats.Spooled++
+	s.stats.Pending++
+	return nil
+}
+
+// Close closes the segment being written. Frames still in the spool stay on
+// disk and are replayed after the next start.
+func (s *spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil {
+		return nil
+	}
+	err := s.active.Close()
+	s.active = nil
+	return err
+}
+
+func (s *spool) last() *spoolSegment {
+	if len(s.segments) == 0 {
+		return nil
+	}
+	return s.segments[len(s.segments)-1]
+}
+
+// rotate closes the active segment and starts a new one.
+func (s *spool) rotate() error {
+	if s.active != nil {
+		s.active.Close()
+		s.active = nil
+	}
+	seq := s.nextSeq
+	path := filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, spoolExt))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	s.nextSeq++
+	s.active = file
+	s.segments = append(s.segments, &spoolSegment{path: path, seq: seq})
+	return nil
+}
+
+// dropOldest removes the oldest segment that is neither being replayed nor
+// written. It returns false when there is none.
+func (s *spool) dropOldest() bool {
+	for i, seg := range s.segments {
+		if seg == s.draining || (s.active != nil && i == len(s.segments)-1) {
+			continue
+		}
+		os.Remove(seg.path)
+		s.segments = append(s.segments[:i], s.segments[i+1:]...)
+		s.stats.Bytes -= seg.size
+		s.stats.Pending -= seg.frames - seg.replayed
+		s.stats.Dropped += uint64(seg.frames - seg.replayed)
+		return true
+	}
+	return false
+}
+
+// Drain replays the spool oldest first through publish and removes each segment
+// once it has been replayed. It stops at the first publish error; the failed
+// frame is replayed again by the next Drain.
+func (s *spool) Drain(publish func(subject, contentType string, data []byte) error) error {
+	for {
+		s.mu.Lock()
+		if len(s.segments) == 0 {
+			s.mu.Unlock()
+			return nil
+		}
+		seg := s.segments[0]
+		if s.active != nil && len(s.segments) == 1 {
+			// New frames go to a fresh segment while this one is replayed
+			s.active.Close()
+			s.active = nil
+		}
+		s.draining = seg
+		s.mu.Unlock()
+
+		err := s.replaySegment(seg, publish)
+
+		s.mu.Lock()
+		s.draining = nil
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		os.Remove(seg.path)
+		s.segments = s.segments[1:]
+		s.stats.Bytes -= seg.size
+		s.stats.Pending -= seg.frames - seg.replayed
+		s.mu.Unlock()
+	}
+}
+
+func (s *spool) replaySegment(seg *spoolSegment, publish func(subject, contentType string, data []byte) error) error {
+	file, err := os.Open(seg.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Seek(seg.offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return nil // a partial last line was cut off by a crash
+		}
+		if err != nil {
+			return err
+		}
+
+		subject, data, ok := bytes.Cut(bytes.TrimSuffix(line, []byte("\n")), []byte(" "))
+		ok = ok && len(subject) > 0 && len(data) > 0
+		contentType := canframe.ContentTypeJSON
+		if ok && data[0] != '{' {
+			contentType = canframe.ContentTypeBinary
+			data, err = base64.StdEncoding.AppendDecode(nil, data)
+			ok = err == nil
+		}
+		if ok {
+			if err := publish(string(subject), contentType, data); err != nil {
+				return err
+			}
+		}
+
+		s.mu.Lock()
+		seg.offset += int64(len(line))
+		seg.replayed++
+		s.stats.Pending--
+		if ok {
+			s.stats.Replayed++
+		} else {
+			s.stats.Dropped++
+		}
+		s.mu.Unlock()
+	}
+}
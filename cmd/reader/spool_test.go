@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/canframe"
+)
+
+// spooledFrame is one frame as replayed by Drain.
+type spooledFrame struct {
+	subject     string
+	contentType string
+	data        string
+}
+
+func openTestSpool(t *testing.T, dir string, maxBytes, segmentBytes int64) *spool {
+	t.Helper()
+	sp, err := openSpool(dir, maxBytes, segmentBytes)
+	if err != nil {
+		t.Fatalf("openSpool: %v", err)
+	}
+	t.Cleanup(func() { sp.Close() })
+	return sp
+}
+
+// appendFrames spools n JSON frames numbered from first and returns them.
+func appendFrames(t *testing.T, sp *spool, first, n int) []spooledFrame {
+	t.Helper()
+	var frames []spooledFrame
+	for i := first; i < first+n; i++ {
+		f := spooledFrame{"can.raw.can0.6B0", canframe.ContentTypeJSON, fmt.Sprintf(`{"n":%03d}`, i)}
+		if err := sp.Append(f.subject, f.contentType, []byte(f.data)); err != nil {
+			t.Fatalf("Append %d: %v", i, err)
+		}
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+func drainAll(t *testing.T, sp *spool) []spooledFrame {
+	t.Helper()
+	var out []spooledFrame
+	if err := sp.Drain(func(subject, contentType string, data []byte) error {
+		out = append(out, spooledFrame{subject, contentType, string(data)})
+		return nil
+	}); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	return out
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+spoolExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestSpoolDrainOrder(t *testing.T) {
+	dir := t.TempDir()
+	sp := openTestSpool(t, dir, 1<<20, 100)
+	want := appendFrames(t, sp, 0, 20)
+	if n := len(segmentFiles(t, dir)); n < 3 {
+		t.Fatalf("%d segments, want several", n)
+	}
+
+	if got := drainAll(t, sp); !reflect.DeepEqual(got, want) {
+		t.Errorf("drained %v, want %v", got, want)
+	}
+	if !sp.Empty() || len(segmentFiles(t, dir)) != 0 {
+		t.Errorf("spool not empty after Drain: %d segments on disk", len(segmentFiles(t, dir)))
+	}
+	if stats := sp.Stats(); stats.Spooled != 20 || stats.Replayed != 20 || stats.Pending != 0 || stats.Bytes != 0 || stats.Dropped != 0 {
+		t.Errorf("stats %+v", stats)
+	}
+}
+
+func TestSpoolDropOldest(t *testing.T) {
+	dir := t.TempDir()
+	// 27-byte lines, three per segment, at most four full segments
+	sp := openTestSpool(t, dir, 400, 105)
+	frames := appendFrames(t, sp, 0, 40)
+
+	stats := sp.Stats()
+	if stats.Bytes > 400 || stats.Dropped == 0 {
+		t.Fatalf("stats %+v, want at most 400 bytes and dropped frames", stats)
+	}
+	got := drainAll(t, sp)
+	// Whole segments are dropped from the front: what is left is the newest frames in order
+	if len(got) == 0 || !reflect.DeepEqual(got, frames[len(frames)-len(got):]) {
+		t.Errorf("drained %v, want the last frames appended", got)
+	}
+	if uint64(len(got))+stats.Dropped != 40 {
+		t.Errorf("%d drained + %d dropped, want 40", len(got), stats.Dropped)
+	}
+}
+
+func TestSpoolResumeAfterFailedPublish(t *testing.T) {
+	dir := t.TempDir()
+	sp := openTestSpool(t, dir, 1<<20, 100)
+	want := appendFrames(t, sp, 0, 12)
+
+	// The fifth publish fails: Drain stops there and the next Drain starts with that frame
+	var got []spooledFrame
+	errPublish := errors.New("no responders")
+	calls := 0
+	publish := func(subject, contentType string, data []byte) error {
+		calls++
+		if calls == 5 {
+			return errPublish
+		}
+		got = append(got, spooledFrame{subject, contentType, string(data)})
+		return nil
+	}
+	if err := sp.Drain(publish); !errors.Is(err, errPublish) {
+		t.Fatalf("Drain = %v, want the publish error", err)
+	}
+	if len(got) != 4 || sp.Stats().Pending != 8 {
+		t.Fatalf("%d published, %d pending after the failure", len(got), sp.Stats().Pending)
+	}
+
+	// Frames spooled in the meantime come after the backlog
+	want = append(want, appendFrames(t, sp, 12, 3)...)
+	if err := sp.Drain(publish); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+}
+
+func TestSpoolPartialLastLine(t *testing.T) {
+	dir := t.TempDir()
+	content := "can.raw {\"n\":1}\ncan.raw {\"n\":2}\ncan.raw {\"n\""
+	if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%020d%s", 7, spoolExt)), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sp := openTestSpool(t, dir, 1<<20, 1<<10)
+	if stats := sp.Stats(); stats.Pending != 2 || stats.Bytes != int64(len(content)) {
+		t.Fatalf("stats %+v, want 2 pending frames", stats)
+	}
+
+	got := drainAll(t, sp)
+	want := []spooledFrame{
+		{"can.raw", canframe.ContentTypeJSON, `{"n":1}`},
+		{"can.raw", canframe.ContentTypeJSON, `{"n":2}`},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("drained %v, want %v", got, want)
+	}
+	if len(segmentFiles(t, dir)) != 0 {
+		t.Error("segment with the partial line left on disk")
+	}
+}
+
+func TestSpoolBinaryFrames(t *testing.T) {
+	dir := t.TempDir()
+	sp := openTestSpool(t, dir, 1<<20, 1<<10)
+	frame := canframe.Frame{ID: "6B0", Length: 3, Data: []byte{'{', '\n', ' '}, Channel: "can0"}
+	binary, err := frame.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sp.Append("can.raw.can0.6B0", canframe.ContentTypeBinary, binary); err != nil {
+		t.Fatal(err)
+	}
+	appendFrames(t, sp, 0, 1)
+
+	// The newline and space in the payload must not split the line
+	data, err := os.ReadFile(segmentFiles(t, dir)[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != 2 {
+		t.Fatalf("%d lines in the segment, want 2", lines)
+	}
+
+	got := drainAll(t, sp)
+	if len(got) != 2 || got[0].contentType != canframe.ContentTypeBinary || got[0].data != string(binary) {
+		t.Fatalf("drained %v, want the binary frame first", got)
+	}
+	if got[1].contentType != canframe.ContentTypeJSON {
+		t.Errorf("JSON frame replayed as %s", got[1].contentType)
+	}
+}
+
+func TestSpoolReopen(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := openSpool(dir, 1<<20, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := appendFrames(t, sp, 0, 10)
+	if err := sp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Not a segment; left alone
+	if err := os.WriteFile(filepath.Join(dir, "notes"+spoolExt), []byte("x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sp = openTestSpool(t, dir, 1<<20, 100)
+	if stats := sp.Stats(); stats.Pending != 10 {
+		t.Fatalf("%d frames pending after reopening, want 10", stats.Pending)
+	}
+	// New segments are numbered after the old ones, so the old frames go first
+	want = append(want, appendFrames(t, sp, 10, 5)...)
+	if got := drainAll(t, sp); !reflect.DeepEqual(got, want) {
+		t.Errorf("drained %v, want %v", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes"+spoolExt)); err != nil {
+		t.Errorf("foreign file removed: %v", err)
+	}
+}
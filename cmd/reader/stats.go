@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/canframe"
+	"github.com/spf13/viper"
+)
+
+// statsConfig holds the reader.stats settings.
+type statsConfig struct {
+	Subject   string
+	Interval  time.Duration
+	AllFrames bool // count the frames the filters drop too, at the cost of the kernel filters
+}
+
+// loadStatsConfig reads reader.stats from the viper configuration.
+func loadStatsConfig() (statsConfig, error) {
+	viper.SetDefault("reader.stats.subject", "can.stats")
+	viper.SetDefault("reader.stats.interval", time.Second)
+	viper.SetDefault("reader.stats.all_frames", false)
+
+	cfg := statsConfig{
+		Subject:   viper.GetString("reader.stats.subject"),
+		Interval:  viper.GetDuration("reader.stats.interval"),
+		AllFrames: viper.GetBool("reader.stats.all_frames"),
+	}
+	if cfg.Interval <= 0 {
+		return cfg, fmt.Errorf("reader.stats.interval must be positive, got %v", cfg.Interval)
+	}
+	return cfg, nil
+}
+
+// busStats is published on reader.stats.subject for every channel once per
+// interval. Rates, load and jitter cover that interval only.
+type busStats struct {
+	Channel      string    `json:"channel"`
+	Interface    string    `json:"interface"`
+	IntervalMs   int64     `json:"interval_ms"`
+	Bitrate      int       `json:"bitrate"`
+	BusLoad      float64   `json:"bus_load"` // percent of the bus time taken by frames
+	Frames       uint64    `json:"frames"`
+	FramesPerSec float64   `json:"frames_per_sec"`
+	ErrorFrames  uint64    `json:"error_frames"`
+	Filtered     bool      `json:"filtered"` // only frames the publish or log filters select are counted
+	IDs          []idStats `json:"ids"`
+	Timestamp    string    `json:"timestamp"`
+}
+
+// idStats are the statistics of one CAN ID. Period and jitter are the mean and
+// standard deviation of the gaps between frames, from the receive timestamps.
+type idStats struct {
+	ID           string  `json:"id"`
+	Type         string  `json:"type"`
+	Count        uint64  `json:"count"`
+	FramesPerSec float64 `json:"frames_per_sec"`
+	PeriodMs     float64 `json:"period_ms,omitempty"`
+	JitterMs     float64 `json:"jitter_ms,omitempty"`
+}
+
+// idKey identifies a CAN ID within a channel; 0x123 standard and extended are
+// different messages.
+type idKey struct {
+	id   string
+	kind string
+}
+
+// idCounter accumulates one ID over an interval. The gaps are summed with
+// Welford's method; last carries over so the first gap of an interval counts.
+type idCounter struct {
+	count uint64
+	last  time.Time
+	gaps  uint64
+	mean  float64
+	m2    float64
+}
+
+// channelStats accumulates one channel over an interval.
+type channelStats struct {
+	ch          channelConfig
+	frames      uint64
+	errorFrames uint64
+	busTime     time.Duration
+	ids         map[idKey]*idCounter
+}
+
+// busStatsCollector computes the live statistics of every channel. It is used
+// from the reader's main loop only and is not safe for concurrent use.
+type busStatsCollector struct {
+	channels map[string]*channelStats
+	order    []string
+	since    time.Time
+	filtered bool
+}
+
+func newBusStatsCollector(channels []channelConfig) *busStatsCollector {
+	c := &busStatsCollector{channels: make(map[string]*channelStats, len(channels)), since: time.Now()}
+	for _, ch := range channels {
+		c.channels[ch.Name] = &channelStats{ch: ch, ids: make(map[idKey]*idCounter)}
+		c.order = append(c.order, ch.Name)
+	}
+	return c
+}
+
+// Observe counts a frame received on its channel.
+func (c *busStatsCollector) Observe(f *canframe.Frame) {
+	cs := c.channels[f.Channel]
+	if cs == nil {
+		return
+	}
+	if f.Error {
+		cs.errorFrames++
+		return
+	}
+	cs.frames++
+	cs.busTime += frameDuration(f, cs.ch.Bitrate, cs.ch.DataBitrate)
+
+	key := idKey{id: f.ID, kind: f.Kind()}
+	ic := cs.ids[key]
+	if ic == nil {
+		ic = &idCounter{}
+		cs.ids[key] = ic
+	}
+	ic.count++
+	at := f.Time()
+	if at.IsZero() {
+		at = time.Now()
+	}
+	if !ic.last.IsZero() && at.After(ic.last) {
+		gap := float64(at.Sub(ic.last)) / float64(time.Millisecond)
+		ic.gaps++
+		delta := gap - ic.mean
+		ic.mean += delta / float64(ic.gaps)
+		ic.m2 += delta * (gap - ic.mean)
+	}
+	ic.last = at
+}
+
+// Snapshot returns the statistics of every channel since the previous call and
+// starts a new interval. IDs that stayed silent for a whole interval are dropped.
+func (c *busStatsCollector) Snapshot(now time.Time) []busStats {
+	elapsed := now.Sub(c.since)
+	c.since = now
+	if elapsed <= 0 {
+		elapsed = time.Nanosecond
+	}
+	seconds := elapsed.Seconds()
+
+	out := make([]busStats, 0, len(c.order))
+	for _, name := range c.order {
+		cs := c.channels[name]
+		stats := busStats{
+			Channel:      cs.ch.Name,
+			Interface:    cs.ch.source(),
+			IntervalMs:   elapsed.Milliseconds(),
+			Bitrate:      cs.ch.Bitrate,
+			BusLoad:      round2(100 * min(cs.busTime.Seconds()/seconds, 1)),
+			Frames:       cs.frames,
+			FramesPerSec: round2(float64(cs.frames) / seconds),
+			ErrorFrames:  cs.errorFrames,
+			Filtered:     c.filtered,
+			IDs:          []idStats{},
+			Timestamp:    now.Format(time.RFC3339Nano),
+		}
+		for key, ic := range cs.ids {
+			if ic.count == 0 {
+				delete(cs.ids, key)
+				continue
+			}
+			id := idStats{
+				ID:           key.id,
+				Type:         key.kind,
+				Count:        ic.count,
+				FramesPerSec: round2(float64(ic.count) / seconds),
+			}
+			if ic.gaps > 0 {
+				id.PeriodMs = round2(ic.mean)
+				id.JitterMs = round2(math.Sqrt(ic.m2 / float64(ic.gaps)))
+			}
+			stats.IDs = append(stats.IDs, id)
+			*ic = idCounter{last: ic.last}
+		}
+		sort.Slice(stats.IDs, func(i, j int) bool {
+			if stats.IDs[i].ID != stats.IDs[j].ID {
+				return stats.IDs[i].ID < stats.IDs[j].ID
+			}
+			return stats.IDs[i].Type < stats.IDs[j].Type
+		})
+		out = append(out, stats)
+
+		cs.frames, cs.errorFrames, cs.busTime = 0, 0, 0
+	}
+	return out
+}
+
+// frameDuration estimates the bus time of a frame, including the 3-bit
+// interframe space and leaving out stuff bits. Classic frames take 47 bits plus
+// the data (67 with an extended ID); CAN FD frames send the arbitration and
+// acknowledgement fields at the nominal rate and, with BRS, the rest at the data
+// rate.
+func frameDuration(f *canframe.Frame, bitrate, dataBitrate int) time.Duration {
+	dataBits := 0
+	if !f.RTR {
+		dataBits = 8 * f.Length
+	}
+
+	var nominal, fast int
+	switch {
+	case !f.FD:
+		nominal = 47 + dataBits
+		if f.Extended {
+			nominal += 20
+		}
+	default:
+		// SOF to BRS, then CRC delimiter, ACK, EOF and interframe space
+		nominal = 17 + 13
+		if f.Extended {
+			nominal += 19
+		}
+		// ESI, DLC, data, stuff count and CRC-17 or CRC-21
+		fast = 26 + dataBits
+		if f.Length > 16 {
+			fast += 4
+		}
+		if !f.BRS {
+			nominal, fast = nominal+fast, 0
+		}
+	}
+
+	d := time.Duration(nominal) * time.Second / time.Duration(bitrate)
+	if fast > 0 {
+		d += time.Duration(fast) * time.Second / time.Duration(dataBitrate)
+	}
+	return d
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -1,10 +1,16 @@
 //***************************************************************************
-// Replays a JSONL CAN log file onto the NATS bus (subject: can.raw) using delta timing from the meta field.
+// Replays a JSONL CAN log file onto the NATS bus using delta timing from the meta field.
 // Usage: replay [-c] <log_file.jsonl>
 // If the -c flag is provided, it will continuously loop the file.
+// The NATS connection is taken from the nats section of config.yaml in the working directory,
+// and frames are sent in the reader's encoding (reader.encoding, binary by default) on the
+// reader's subjects (reader.subjects, can.raw.<channel>.<id> by default). Frames without a
+// channel go to can.raw.
 //
 // The meta field in each JSON message contains the delta time in milliseconds since the last message.
-// This allows for accurate replay of CAN bus timing patterns.
+// This allows for accurate replay of CAN bus timing patterns. Captures with the
+// absolute timestamp field are replayed with its nanosecond spacing instead, and
+// each frame is re-stamped with the time it is published.
 //
 // By Erik Wästlin in 2025
 //
@@ -15,23 +21,21 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/canframe"
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/natsconf"
 	"github.com/nats-io/nats.go"
+	"github.com/spf13/viper"
 )
 
-// CANMessage represents a CAN message from the log file
-type CANMessage struct {
-	ID     string `json:"id"`
-	Length int    `json:"length"`
-	Data   string `json:"data"`
-	Meta   int    `json:"meta"` // Delta time in milliseconds
-}
-
 func main() {
 	// Parse arguments
 	continuous := false
@@ -49,11 +53,37 @@ func main() {
 		os.Exit(1)
 	}
 
-	nc, err := nats.Connect(nats.DefaultURL)
+	// The NATS connection comes from config.yaml in the working directory, if there is one
+	viper.SetConfigName("config")
+	viper.SetConfigType("yaml")
+	viper.AddConfigPath(".")
+	if err := viper.ReadInConfig(); err != nil {
+		if _, notFound := err.(viper.ConfigFileNotFoundError); !notFound {
+			log.Fatalf("Error reading config file: %v", err)
+		}
+	}
+	// Frames go out in the reader's wire encoding and subject layout
+	viper.SetDefault("reader.encoding", canframe.EncodingBinary)
+	contentType, err := canframe.ContentType(viper.GetString("reader.encoding"))
+	if err != nil {
+		log.Fatalf("Invalid config: reader.encoding: %v", err)
+	}
+	subjectLayout, err := natsconf.LoadSubjectLayout()
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	natsCfg, err := natsconf.Load("replay")
+	if err != nil {
+		log.Fatalf("Invalid NATS config: %v", err)
+	}
+	nc, err := natsCfg.Connect()
 	if err != nil {
 		log.Fatalf("Failed to connect to NATS: %v", err)
 	}
-	defer nc.Drain()
+
+	// SIGINT and SIGTERM stop the replay after the current frame
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	log.Printf("Starting CAN replay from file: %s", logFilePath)
 	if continuous {
@@ -61,6 +91,7 @@ func main() {
 	}
 
 	replayCount := 0
+replay:
 	for {
 		replayCount++
 		if continuous {
@@ -74,13 +105,18 @@ func main() {
 
 		scanner := bufio.NewScanner(file)
 		messageCount := 0
+		var lastTimestamp int64
 
 		for scanner.Scan() {
+			if ctx.Err() != nil {
+				file.Close()
+				break replay
+			}
 			line := scanner.Text()
 			messageCount++
 
 			// Parse the JSON to extract the meta (delta time) field
-			var canMsg CANMessage
+			var canMsg canframe.Frame
 			err := json.Unmarshal([]byte(line), &canMsg)
 			if err != nil {
 				log.Printf("Failed to parse JSON message %d: %v", messageCount, err)
@@ -88,17 +124,49 @@ func main() {
 				continue
 			}
 
-			// Wait for the delta time specified in the meta field (in milliseconds)
-			if canMsg.Meta > 0 {
-				sleepDuration := time.Duration(canMsg.Meta) * time.Millisecond
-				if canMsg.Meta > 100 { // Only log longer delays to reduce spam
-					log.Printf("Message %d (ID: %s): Waiting %dms", messageCount, canMsg.ID, canMsg.Meta)
+			// Wait for the delta time: from the frame timestamps when the capture has
+			// them, otherwise from the meta field (in milliseconds)
+			sleepDuration := time.Duration(canMsg.Meta) * time.Millisecond
+			if canMsg.Timestamp != 0 && lastTimestamp != 0 {
+				sleepDuration = time.Duration(canMsg.Timestamp - lastTimestamp)
+			}
+			lastTimestamp = canMsg.Timestamp
+			if sleepDuration > 0 {
+				if sleepDuration > 100*time.Millisecond { // Only log longer delays to reduce spam
+					log.Printf("Message %d (ID: %s, %s): Waiting %dms", messageCount, canMsg.ID, canMsg.Kind(), sleepDuration.Milliseconds())
+				}
+				select {
+				case <-ctx.Done():
+					file.Close()
+					break replay
+				case <-time.After(sleepDuration):
 				}
-				time.Sleep(sleepDuration)
 			}
 
-			// Publish the original JSON message to the bus
-			err = nc.Publish("can.raw", []byte(line))
+			// Older captures write "36" for 036 and 1FFFFFF0 without the extended
+			// flag; frames that are invalid either way are skipped
+			if err := canMsg.Normalize(); err != nil {
+				log.Printf("Skipping message %d: %v", messageCount, err)
+				continue
+			}
+
+			// Publish the message to the bus; the extended, rtr, error and FD (fd,
+			// brs, esi) flags travel with it unchanged. Timestamped frames are
+			// re-stamped so the handler sees current times. JSON lines go out as
+			// they are when nothing changed.
+			msg := nats.NewMsg(natsconf.FrameSubject(subjectLayout, &canMsg))
+			msg.Header.Set(canframe.ContentTypeHeader, contentType)
+			msg.Data = []byte(line)
+			if canMsg.Timestamp != 0 || contentType != canframe.ContentTypeJSON {
+				if canMsg.Timestamp != 0 {
+					canMsg.Timestamp = time.Now().UnixNano()
+				}
+				if msg.Data, err = canframe.Encode(&canMsg, contentType); err != nil {
+					log.Printf("Failed to encode message %d: %v", messageCount, err)
+					continue
+				}
+			}
+			err = nc.PublishMsg(msg)
 			if err != nil {
 				log.Printf("Failed to publish message %d: %v", messageCount, err)
 				continue
@@ -124,8 +192,19 @@ func main() {
 
 		// Small pause between iterations in continuous mode
 		log.Println("Pausing 1 second before next iteration...")
-		time.Sleep(1 * time.Second)
+		select {
+		case <-ctx.Done():
+			break replay
+		case <-time.After(time.Second):
+		}
 	}
 
-	log.Println("Replay complete.")
+	if ctx.Err() != nil {
+		log.Println("Replay stopped.")
+	} else {
+		log.Println("Replay complete.")
+	}
+	if err := natsconf.Close(nc, 2*time.Second); err != nil {
+		log.Printf("Error flushing NATS: %v", err)
+	}
 }
@@ -7,11 +7,15 @@ import (
 	"os"
 	"sort"
 	"strconv"
-	"strings"
+
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/canframe"
 )
 
-type canMessage struct {
-	ID string `json:"id"`
+// frameKey groups frames by channel, identifier and frame type.
+type frameKey struct {
+	channel string
+	id      string
+	kind    string
 }
 
 var idDescriptions = map[string]string{
@@ -47,10 +51,10 @@ func main() {
 	}
 	defer file.Close()
 
-	counts := make(map[string]int)
+	counts := make(map[frameKey]int)
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		var msg canMessage
+		var msg canframe.Frame
 		line := scanner.Bytes()
 		if err := json.Unmarshal(line, &msg); err != nil {
 			fmt.Fprintf(os.Stderr, "Skipping invalid JSON: %v\n", err)
@@ -59,30 +63,48 @@ func main() {
 		if msg.ID == "" {
 			continue
 		}
-		counts[strings.ToUpper(msg.ID)]++
+		// Older captures write "36" for 036 and carry no extended flag
+		if err := msg.Normalize(); err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping frame: %v\n", err)
+			continue
+		}
+		channel := msg.Channel
+		if channel == "" {
+			channel = "-" // captures from before channel tagging
+		}
+		counts[frameKey{channel: channel, id: msg.ID, kind: msg.Kind()}]++
 	}
 	if err := scanner.Err(); err != nil {
 		fmt.Fprintf(os.Stderr, "Scanner error: %v\n", err)
 		os.Exit(1)
 	}
 
-	ids := make([]string, 0, len(counts))
-	for id := range counts {
-		ids = append(ids, id)
+	keys := make([]frameKey, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
 	}
-	sort.Slice(ids, func(i, j int) bool {
-		iVal, _ := strconv.ParseInt(ids[i], 16, 32)
-		jVal, _ := strconv.ParseInt(ids[j], 16, 32)
-		return iVal < jVal
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].channel != keys[j].channel {
+			return keys[i].channel < keys[j].channel
+		}
+		if len(keys[i].id) != len(keys[j].id) {
+			return len(keys[i].id) < len(keys[j].id)
+		}
+		iVal, _ := strconv.ParseInt(keys[i].id, 16, 64)
+		jVal, _ := strconv.ParseInt(keys[j].id, 16, 64)
+		if iVal != jVal {
+			return iVal < jVal
+		}
+		return keys[i].kind < keys[j].kind
 	})
 
-	fmt.Printf("%-6s %-7s %s\n", "ID", "Count", "Description")
-	fmt.Println("----------------------------------------------")
-	for _, id := range ids {
-		desc := idDescriptions[id]
-		if desc == "" {
-			desc = "-"
+	fmt.Printf("%-10s %-9s %-8s %-7s %s\n", "Channel", "ID", "Type", "Count", "Description")
+	fmt.Println("------------------------------------------------------------------")
+	for _, key := range keys {
+		desc := "-"
+		if key.kind == "std" && idDescriptions[key.id] != "" {
+			desc = idDescriptions[key.id]
 		}
-		fmt.Printf("%-6s %-7d %s\n", id, counts[id], desc)
+		fmt.Printf("%-10s %-9s %-8s %-7d %s\n", key.channel, key.id, key.kind, counts[key], desc)
 	}
 }
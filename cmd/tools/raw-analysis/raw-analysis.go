@@ -7,8 +7,17 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/canframe"
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/slcan"
 )
 
+// frameKey groups frames by identifier and frame type.
+type frameKey struct {
+	id   string
+	kind string
+}
+
 func main() {
 	if len(os.Args) != 2 {
 		fmt.Printf("Usage: %s <raw_file>\n", os.Args[0])
@@ -23,35 +32,47 @@ func main() {
 	}
 	defer file.Close()
 
-	counts := make(map[string]int)
+	counts := make(map[frameKey]int)
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
-		if !strings.HasPrefix(line, "t") || len(line) < 4 {
+		if len(line) == 0 {
 			continue
 		}
-		idHex := line[1:4]
-		counts[strings.ToUpper(idHex)]++
+		frame, _, _, err := slcan.ParseFrame([]byte(line))
+		if err != nil {
+			continue
+		}
+		// Grouped by the frame types of the JSON tools (std, ext, rtr, ext-rtr, fd, ext-fd)
+		f := canframe.Frame{Extended: frame.Extended, RTR: frame.RTR, FD: frame.FD}
+		key := frameKey{id: canframe.FormatID(frame.ID, frame.Extended), kind: f.Kind()}
+		counts[key]++
 	}
 	if err := scanner.Err(); err != nil {
 		fmt.Fprintf(os.Stderr, "Scanner error: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Sort and print by ID
-	ids := make([]string, 0, len(counts))
-	for id := range counts {
-		ids = append(ids, id)
+	// Sort and print by ID, standard IDs first
+	keys := make([]frameKey, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
 	}
-	sort.Slice(ids, func(i, j int) bool {
-		iVal, _ := strconv.ParseInt(ids[i], 16, 32)
-		jVal, _ := strconv.ParseInt(ids[j], 16, 32)
-		return iVal < jVal
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i].id) != len(keys[j].id) {
+			return len(keys[i].id) < len(keys[j].id)
+		}
+		iVal, _ := strconv.ParseInt(keys[i].id, 16, 64)
+		jVal, _ := strconv.ParseInt(keys[j].id, 16, 64)
+		if iVal != jVal {
+			return iVal < jVal
+		}
+		return keys[i].kind < keys[j].kind
 	})
 
-	fmt.Printf("%-6s %s\n", "ID", "Count")
-	fmt.Println("----------------")
-	for _, id := range ids {
-		fmt.Printf("%-6s %d\n", id, counts[id])
+	fmt.Printf("%-9s %-8s %s\n", "ID", "Type", "Count")
+	fmt.Println("-------------------------")
+	for _, key := range keys {
+		fmt.Printf("%-9s %-8s %d\n", key.id, key.kind, counts[key])
 	}
 }
@@ -1,5 +1,7 @@
 // ***************************************************************************
 // Converts a raw CAN log file to a structured JSON format.
+// Reads slcan frame lines: standard (t) and extended (T) data frames, remote (r/R) frames and
+// CAN FD frames without (d/D) and with (b/B) bit rate switch.
 // Usage: raw-convert <raw_input_file> <output_file>
 // The output file will be overwritten if it already exists.
 //
@@ -15,14 +17,37 @@ import (
 	"encoding/json"
 	"log"
 	"os"
-	"strconv"
+	"strings"
+
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/canframe"
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/slcan"
 )
 
-type CANMessage struct {
-	ID     string `json:"id"`
-	Length int    `json:"length"`
-	Data   string `json:"data"`
-	Meta   string `json:"meta"`
+// slcanTimestampWrap is the period of the optional slcan timestamp (milliseconds, 0-59999).
+const slcanTimestampWrap = 60000
+
+// parseLine parses one slcan (LAWICEL) frame line with slcan.ParseFrame, e.g.
+// "t6B18<data>", "T1FFFFFF08<data>" or "b123F<128 hex chars>". The optional
+// 4-digit timestamp after the data is returned in ms, or -1 when absent.
+func parseLine(line string) (canframe.Frame, int, error) {
+	f, ms, stamped, err := slcan.ParseFrame([]byte(line))
+	if err != nil {
+		return canframe.Frame{}, -1, err
+	}
+	frame := canframe.Frame{
+		ID:       canframe.FormatID(f.ID, f.Extended),
+		Length:   int(f.Length),
+		Data:     f.Payload(),
+		Extended: f.Extended,
+		RTR:      f.RTR,
+		FD:       f.FD,
+		BRS:      f.BRS,
+	}
+	timestamp := -1
+	if stamped {
+		timestamp = int(ms)
+	}
+	return frame, timestamp, nil
 }
 
 func main() {
@@ -52,34 +77,26 @@ func main() {
 	defer writer.Flush()
 
 	scanner := bufio.NewScanner(inputFile)
+	lastTimestamp := -1
 
 	// Process each line in the input file
 	for scanner.Scan() {
-		line := scanner.Text()
-
-		if len(line) < 8 {
-			log.Printf("Skipping line (too short): %s", line)
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
 			continue
 		}
 
-		id := line[1:4]        // 3-byte ID (6 hex chars)
-		lengthHex := line[4:5] // 1-byte length (2 hex chars)
-		length, err := strconv.ParseUint(lengthHex, 16, 8)
-
-		if err != nil || length == 0 {
-			log.Printf("Skipping line (invalid length): %s", line)
+		msg, timestamp, err := parseLine(line)
+		if err != nil {
+			log.Printf("Skipping line (%v): %s", err, line)
 			continue
 		}
 
-		data := line[5 : 5+length*2] // Data bytes (length * 2 hex chars)
-		meta := line[5+length*2:]    // Remaining metadata
-
-		msg := CANMessage{
-			ID:     id,
-			Length: int(length),
-			Data:   data,
-			Meta:   meta,
+		// Meta is the delta since the previous frame, from the slcan timestamp
+		if timestamp >= 0 && lastTimestamp >= 0 {
+			msg.Meta = int64((timestamp - lastTimestamp + slcanTimestampWrap) % slcanTimestampWrap)
 		}
+		lastTimestamp = timestamp
 
 		jsonBytes, _ := json.Marshal(msg)
 		writer.WriteString(string(jsonBytes) + "\n")
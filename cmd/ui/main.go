@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -37,6 +42,23 @@ func loadConfig(configPath string) (*Config, error) {
 	return &config, nil
 }
 
+// serveDataFile returns a handler that streams a JSON file written by the handler as-is.
+func serveDataFile(path string) http.HandlerFunc {
+	name := filepath.Base(path)
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Printf("Error opening %s: %v", name, err)
+			http.Error(w, name+" not available", http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.Copy(w, f) // stream file content as-is
+	}
+}
+
 func main() {
 	var configPath string
 	flag.StringVar(&configPath, "config", "config.yaml", "Path to configuration file")
@@ -51,47 +73,79 @@ func main() {
 	// Build paths
 	evDataPath := filepath.Join(config.Paths.DataFolder, "ev_data.json")
 	mainDataPath := filepath.Join(config.Paths.DataFolder, "main_data.json")
+	cellsPath := filepath.Join(config.Paths.DataFolder, "cells.json")
+	thermistorsPath := filepath.Join(config.Paths.DataFolder, "thermistors.json")
+	signalsPath := filepath.Join(config.Paths.DataFolder, "signals.json")
+	inverterPath := filepath.Join(config.Paths.DataFolder, "inverter_data.json")
+	alertsPath := filepath.Join(config.Paths.DataFolder, "alerts.json")
+	freshnessPath := filepath.Join(config.Paths.DataFolder, "freshness.json")
 	staticPath := config.Paths.UIStaticFolder
 
 	log.Printf("Config loaded from: %s", configPath)
 	log.Printf("EV data path: %s", evDataPath)
 	log.Printf("Main data path: %s", mainDataPath)
+	log.Printf("Cells path: %s", cellsPath)
+	log.Printf("Thermistors path: %s", thermistorsPath)
+	log.Printf("Signals path: %s", signalsPath)
+	log.Printf("Inverter path: %s", inverterPath)
+	log.Printf("Alerts path: %s", alertsPath)
+	log.Printf("Freshness path: %s", freshnessPath)
 	log.Printf("Static path: %s", staticPath)
 	log.Printf("UI port: %d", config.Server.UIPort)
 
 	// Serve ev_data.json as the main API endpoint
-	http.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
-		f, err := os.Open(evDataPath)
-		if err != nil {
-			log.Printf("Error opening ev_data.json: %v", err)
-			http.Error(w, "ev_data.json not available", http.StatusInternalServerError)
-			return
-		}
-		defer f.Close()
-
-		w.Header().Set("Content-Type", "application/json")
-		_, _ = io.Copy(w, f) // stream file content as-is
-	})
+	http.HandleFunc("/api", serveDataFile(evDataPath))
 
 	// Serve main_data.json for extended telemetry
-	http.HandleFunc("/api/main", func(w http.ResponseWriter, r *http.Request) {
-		f, err := os.Open(mainDataPath)
-		if err != nil {
-			log.Printf("Error opening main_data.json: %v", err)
-			http.Error(w, "main_data.json not available", http.StatusInternalServerError)
-			return
-		}
-		defer f.Close()
+	http.HandleFunc("/api/main", serveDataFile(mainDataPath))
 
-		w.Header().Set("Content-Type", "application/json")
-		_, _ = io.Copy(w, f)
-	})
+	// Serve cells.json with the per-cell voltage map
+	http.HandleFunc("/api/cells", serveDataFile(cellsPath))
+
+	// Serve thermistors.json with the per-thermistor temperatures
+	http.HandleFunc("/api/thermistors", serveDataFile(thermistorsPath))
+
+	// Serve inverter_data.json with the Tesla drive-inverter state
+	http.HandleFunc("/api/inverter", serveDataFile(inverterPath))
+
+	// Serve alerts.json with the alert-matrix fault catalogue
+	http.HandleFunc("/api/alerts", serveDataFile(alertsPath))
+
+	// Serve freshness.json with per-message timeouts and node status
+	http.HandleFunc("/api/freshness", serveDataFile(freshnessPath))
+
+	// Serve signals.json with every DBC-decoded message
+	http.HandleFunc("/api/signals", serveDataFile(signalsPath))
 
 	// Serve static files (index.html etc.)
 	fs := http.FileServer(http.Dir(staticPath))
 	http.Handle("/", fs)
 
 	addr := fmt.Sprintf(":%d", config.Server.UIPort)
+	server := &http.Server{Addr: addr}
+
+	// SIGINT and SIGTERM (systemctl stop) let running requests finish before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var shutdownErr error
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		log.Println("Shutting down UI server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownErr = server.Shutdown(shutdownCtx)
+	}()
+
 	log.Printf("UI server running on http://localhost%s", addr)
-	log.Fatal(http.ListenAndServe(addr, nil))
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	// ListenAndServe returns as soon as Shutdown starts; wait for running requests
+	<-shutdownDone
+	if shutdownErr != nil {
+		log.Printf("UI server shutdown: %v", shutdownErr)
+	}
+	log.Println("UI server stopped")
 }
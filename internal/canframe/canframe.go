@@ -0,0 +1,235 @@
+// Package canframe defines the JSON frame schema shared by the reader, handler,
+// replay and the log tools: one object per frame on can.raw and per line in the
+// canbus.json capture.
+//
+//	{"id":"6B0","length":8,"data":"00A100486E50005F","meta":39,"timestamp":1762366801123456789,"channel":"bms"}
+//	{"id":"1FFFFFF0","length":8,"data":"0119000708000043","meta":2,"extended":true}
+//	{"id":"7DF","length":0,"data":"","meta":0,"rtr":true}
+//	{"id":"00000004","length":8,"data":"0004000000000000","meta":0,"error":true}
+//	{"id":"18FF50E5","length":12,"data":"000102030405060708090A0B","meta":1,"extended":true,"fd":true,"brs":true}
+package canframe
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// MaxStandardID is the largest 11-bit identifier.
+	MaxStandardID = 0x7FF
+	// MaxExtendedID is the largest 29-bit identifier.
+	MaxExtendedID = 0x1FFFFFFF
+	// MaxDataLength is the payload size of a classic CAN frame.
+	MaxDataLength = 8
+	// MaxFDDataLength is the payload size of a CAN FD frame.
+	MaxFDDataLength = 64
+)
+
+// fdLengths maps the CAN FD DLC codes 9-15 to payload lengths.
+var fdLengths = [...]int{9: 12, 10: 16, 11: 20, 12: 24, 13: 32, 14: 48, 15: 64}
+
+// DLCToLength returns the payload length for a 4-bit DLC. Classic frames cap
+// DLC 9-15 at 8 bytes, FD frames map them to 12-64 bytes.
+func DLCToLength(dlc uint8, fd bool) int {
+	switch {
+	case dlc <= 8:
+		return int(dlc)
+	case !fd:
+		return MaxDataLength
+	case dlc <= 15:
+		return fdLengths[dlc]
+	}
+	return MaxFDDataLength
+}
+
+// LengthToDLC returns the smallest DLC whose payload holds n bytes. FD payloads
+// between the valid sizes are padded up to the next one by the sender.
+func LengthToDLC(n int) uint8 {
+	if n <= 8 {
+		return uint8(max(n, 0))
+	}
+	for dlc := uint8(9); dlc < 15; dlc++ {
+		if fdLengths[dlc] >= n {
+			return dlc
+		}
+	}
+	return 15
+}
+
+// ValidLength reports whether n is a payload length a frame can carry.
+func ValidLength(n int, fd bool) bool {
+	if !fd {
+		return n >= 0 && n <= MaxDataLength
+	}
+	return n >= 0 && n <= MaxFDDataLength && DLCToLength(LengthToDLC(n), true) == n
+}
+
+// Frame is one CAN frame. The payload is written as uppercase hex in JSON (see
+// MarshalJSON), and the flags are omitted when false, so standard data frames
+// keep the original layout plus the timestamp.
+type Frame struct {
+	ID        string
+	Length    int
+	Data      []byte
+	Meta      int64  // Delta time in milliseconds since the previous frame
+	Timestamp int64  // Receive time in nanoseconds since the Unix epoch
+	Channel   string // Reader channel (bus) the frame was received on
+	Extended  bool   // 29-bit identifier
+	RTR       bool   // Remote transmission request, carries no data
+	Error     bool   // Error frame, ID holds the CAN_ERR_* class bits
+	FD        bool   // CAN FD frame, up to 64 data bytes
+	BRS       bool   // FD bit rate switch, data phase sent at the fast rate
+	ESI       bool   // FD error state indicator, sender is error passive
+}
+
+// jsonFrame is the JSON layout of a Frame.
+type jsonFrame struct {
+	ID        string `json:"id"`
+	Length    int    `json:"length"`
+	Data      string `json:"data"`
+	Meta      int64  `json:"meta"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+	Channel   string `json:"channel,omitempty"`
+	Extended  bool   `json:"extended,omitempty"`
+	RTR       bool   `json:"rtr,omitempty"`
+	Error     bool   `json:"error,omitempty"`
+	FD        bool   `json:"fd,omitempty"`
+	BRS       bool   `json:"brs,omitempty"`
+	ESI       bool   `json:"esi,omitempty"`
+}
+
+// MarshalJSON encodes the frame with the payload as uppercase hex.
+func (f Frame) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonFrame{
+		ID:        f.ID,
+		Length:    f.Length,
+		Data:      fmt.Sprintf("%X", f.Data),
+		Meta:      f.Meta,
+		Timestamp: f.Timestamp,
+		Channel:   f.Channel,
+		Extended:  f.Extended,
+		RTR:       f.RTR,
+		Error:     f.Error,
+		FD:        f.FD,
+		BRS:       f.BRS,
+		ESI:       f.ESI,
+	})
+}
+
+// UnmarshalJSON decodes a frame written by MarshalJSON; the hex payload may be
+// in either case.
+func (f *Frame) UnmarshalJSON(b []byte) error {
+	var j jsonFrame
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	data, err := hex.DecodeString(j.Data)
+	if err != nil {
+		return fmt.Errorf("CAN ID %s: invalid data: %w", j.ID, err)
+	}
+	*f = Frame{
+		ID:        j.ID,
+		Length:    j.Length,
+		Data:      data,
+		Meta:      j.Meta,
+		Timestamp: j.Timestamp,
+		Channel:   j.Channel,
+		Extended:  j.Extended,
+		RTR:       j.RTR,
+		Error:     j.Error,
+		FD:        j.FD,
+		BRS:       j.BRS,
+		ESI:       j.ESI,
+	}
+	return nil
+}
+
+// Time returns the receive time of the frame, or the zero time for captures
+// recorded before timestamps were added.
+func (f *Frame) Time() time.Time {
+	if f.Timestamp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, f.Timestamp)
+}
+
+// FormatID formats an identifier as three hex digits for standard frames and
+// eight for extended and error frames, e.g. "036" and "1FFFFFF0".
+func FormatID(id uint32, wide bool) string {
+	if wide {
+		return fmt.Sprintf("%08X", id)
+	}
+	return fmt.Sprintf("%03X", id)
+}
+
+// ParseID parses a hex identifier as written in the ID field.
+func ParseID(id string) (uint32, error) {
+	value, err := strconv.ParseUint(id, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid CAN ID %q: %w", id, err)
+	}
+	return uint32(value), nil
+}
+
+// CANID returns the numeric identifier of the frame.
+func (f *Frame) CANID() (uint32, error) {
+	id, err := ParseID(f.ID)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case f.Error:
+	case f.Extended && id > MaxExtendedID:
+		return 0, fmt.Errorf("extended CAN ID %q out of range", f.ID)
+	case !f.Extended && id > MaxStandardID:
+		return 0, fmt.Errorf("standard CAN ID %q out of range", f.ID)
+	}
+	return id, nil
+}
+
+// Normalize rewrites the ID in the canonical width. Captures recorded before the
+// extended flag existed wrote every ID with %X, so an ID above the 11-bit range
+// marks the frame as extended and "36" becomes "036". It also checks that the
+// length is valid for a classic or FD frame and matches the data.
+func (f *Frame) Normalize() error {
+	id, err := ParseID(f.ID)
+	if err != nil {
+		return err
+	}
+	if !f.Error && !f.Extended && id > MaxStandardID {
+		f.Extended = true
+	}
+	if _, err := f.CANID(); err != nil {
+		return err
+	}
+	if !ValidLength(f.Length, f.FD) {
+		return fmt.Errorf("CAN ID %s: invalid length %d", f.ID, f.Length)
+	}
+	if !f.RTR && len(f.Data) != f.Length {
+		return fmt.Errorf("CAN ID %s: %d data bytes for length %d", f.ID, len(f.Data), f.Length)
+	}
+	f.ID = FormatID(id, f.Extended || f.Error)
+	return nil
+}
+
+// Kind describes the frame type for logs and tool output.
+func (f *Frame) Kind() string {
+	switch {
+	case f.Error:
+		return "error"
+	case f.RTR && f.Extended:
+		return "ext-rtr"
+	case f.RTR:
+		return "rtr"
+	case f.FD && f.Extended:
+		return "ext-fd"
+	case f.FD:
+		return "fd"
+	case f.Extended:
+		return "ext"
+	}
+	return "std"
+}
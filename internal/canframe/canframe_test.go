@@ -0,0 +1,116 @@
+package canframe
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestDLCMapping(t *testing.T) {
+	tests := []struct {
+		dlc     uint8
+		classic int
+		fd      int
+	}{
+		{0, 0, 0}, {8, 8, 8}, {9, 8, 12}, {10, 8, 16}, {11, 8, 20},
+		{12, 8, 24}, {13, 8, 32}, {14, 8, 48}, {15, 8, 64},
+	}
+	for _, tt := range tests {
+		if got := DLCToLength(tt.dlc, false); got != tt.classic {
+			t.Errorf("DLCToLength(%d, classic) = %d, want %d", tt.dlc, got, tt.classic)
+		}
+		if got := DLCToLength(tt.dlc, true); got != tt.fd {
+			t.Errorf("DLCToLength(%d, fd) = %d, want %d", tt.dlc, got, tt.fd)
+		}
+		if got := LengthToDLC(tt.fd); got != tt.dlc {
+			t.Errorf("LengthToDLC(%d) = %d, want %d", tt.fd, got, tt.dlc)
+		}
+	}
+	// FD payloads between the valid sizes are padded up
+	if got := LengthToDLC(13); got != 10 {
+		t.Errorf("LengthToDLC(13) = %d, want 10", got)
+	}
+}
+
+func TestValidLength(t *testing.T) {
+	for _, n := range []int{0, 8} {
+		if !ValidLength(n, false) || !ValidLength(n, true) {
+			t.Errorf("ValidLength(%d) = false", n)
+		}
+	}
+	for _, n := range []int{12, 48, 64} {
+		if ValidLength(n, false) || !ValidLength(n, true) {
+			t.Errorf("ValidLength(%d) wrong for classic or FD", n)
+		}
+	}
+	for _, n := range []int{-1, 9, 13, 65} {
+		if ValidLength(n, true) {
+			t.Errorf("ValidLength(%d, fd) = true", n)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in       Frame
+		id       string
+		extended bool
+	}{
+		{Frame{ID: "36", Length: 1, Data: []byte{1}}, "036", false},
+		{Frame{ID: "1FFFFFF0", Length: 0}, "1FFFFFF0", true},
+		{Frame{ID: "100", Length: 0, Extended: true}, "00000100", true},
+		{Frame{ID: "4", Length: 8, Data: make([]byte, 8), Error: true}, "00000004", false},
+		{Frame{ID: "7DF", Length: 8, RTR: true}, "7DF", false},
+	}
+	for _, tt := range tests {
+		f := tt.in
+		if err := f.Normalize(); err != nil {
+			t.Errorf("Normalize(%+v): %v", tt.in, err)
+			continue
+		}
+		if f.ID != tt.id || f.Extended != tt.extended {
+			t.Errorf("Normalize(%+v) = ID %s extended %v, want %s %v", tt.in, f.ID, f.Extended, tt.id, tt.extended)
+		}
+	}
+
+	for _, f := range []Frame{
+		{ID: "XYZ"},
+		{ID: "20000000", Extended: true},
+		{ID: "123", Length: 9, Data: make([]byte, 9)},
+		{ID: "123", Length: 2, Data: []byte{1}},
+		{ID: "123", Length: 13, Data: make([]byte, 13), FD: true},
+	} {
+		if err := f.Normalize(); err == nil {
+			t.Errorf("Normalize(%+v) accepted", f)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	line := []byte(`{"id":"18FF50E5","length":12,"data":"000102030405060708090A0B","meta":1,"timestamp":1762366801123456789,"channel":"bms","extended":true,"fd":true,"brs":true}`)
+	var f Frame
+	if err := json.Unmarshal(line, &f); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Data) != 12 || f.Data[11] != 0x0B || f.Channel != "bms" || !f.BRS {
+		t.Errorf("Unmarshal = %+v", f)
+	}
+	out, err := json.Marshal(&f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, line) {
+		t.Errorf("Marshal = %s, want %s", out, line)
+	}
+
+	// Lowercase hex is accepted and written back in uppercase
+	if err := json.Unmarshal([]byte(`{"id":"6B0","length":2,"data":"abcd","meta":0}`), &f); err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := json.Marshal(f); !bytes.Equal(out, []byte(`{"id":"6B0","length":2,"data":"ABCD","meta":0}`)) {
+		t.Errorf("Marshal = %s", out)
+	}
+	if err := json.Unmarshal([]byte(`{"id":"6B0","length":1,"data":"0G","meta":0}`), &f); err == nil {
+		t.Error("invalid hex accepted")
+	}
+}
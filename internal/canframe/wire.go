@@ -0,0 +1,161 @@
+package canframe
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ContentTypeHeader is the NATS message header naming the encoding of a raw
+// frame. Messages without it are JSON, as published by older readers.
+const ContentTypeHeader = "Content-Type"
+
+// Wire encodings of raw frames.
+const (
+	ContentTypeJSON   = "application/json"
+	ContentTypeBinary = "application/vnd.wecan.can-frame"
+)
+
+// Encodings as written in the configuration.
+const (
+	EncodingJSON   = "json"
+	EncodingBinary = "binary"
+)
+
+// ContentType returns the content type of an encoding name from the
+// configuration.
+func ContentType(encoding string) (string, error) {
+	switch encoding {
+	case EncodingJSON:
+		return ContentTypeJSON, nil
+	case EncodingBinary:
+		return ContentTypeBinary, nil
+	}
+	return "", fmt.Errorf("unknown frame encoding %q, want json or binary", encoding)
+}
+
+// Binary frame layout, little endian:
+//
+//	0      version (binaryVersion)
+//	1      flags (binaryExtended, ...)
+//	2      length, the DLC for RTR frames
+//	3      channel name length n
+//	4:8    CAN ID, with the error class bits for error frames
+//	8:16   receive time in nanoseconds since the Unix epoch, 0 if unknown
+//	16:24  meta, milliseconds since the previous frame
+//	24:    channel name (n bytes), then the data (length bytes, none for RTR)
+const (
+	binaryVersion    = 1
+	binaryHeaderSize = 24
+)
+
+const (
+	binaryExtended = 1 << iota
+	binaryRTR
+	binaryError
+	binaryFD
+	binaryBRS
+	binaryESI
+)
+
+// MarshalBinary encodes the frame in the compact binary layout.
+func (f *Frame) MarshalBinary() ([]byte, error) {
+	id, err := f.CANID()
+	if err != nil {
+		return nil, err
+	}
+	if f.Length < 0 || f.Length > MaxFDDataLength {
+		return nil, fmt.Errorf("CAN ID %s: invalid length %d", f.ID, f.Length)
+	}
+	if len(f.Channel) > 255 {
+		return nil, fmt.Errorf("channel name %q too long", f.Channel)
+	}
+	if !f.RTR && len(f.Data) != f.Length {
+		return nil, fmt.Errorf("CAN ID %s: %d data bytes for length %d", f.ID, len(f.Data), f.Length)
+	}
+
+	var flags byte
+	setFlag := func(bit byte, set bool) {
+		if set {
+			flags |= bit
+		}
+	}
+	setFlag(binaryExtended, f.Extended)
+	setFlag(binaryRTR, f.RTR)
+	setFlag(binaryError, f.Error)
+	setFlag(binaryFD, f.FD)
+	setFlag(binaryBRS, f.BRS)
+	setFlag(binaryESI, f.ESI)
+
+	b := make([]byte, binaryHeaderSize, binaryHeaderSize+len(f.Channel)+len(f.Data))
+	b[0] = binaryVersion
+	b[1] = flags
+	b[2] = byte(f.Length)
+	b[3] = byte(len(f.Channel))
+	binary.LittleEndian.PutUint32(b[4:8], id)
+	binary.LittleEndian.PutUint64(b[8:16], uint64(f.Timestamp))
+	binary.LittleEndian.PutUint64(b[16:24], uint64(f.Meta))
+	b = append(b, f.Channel...)
+	if !f.RTR {
+		b = append(b, f.Data...)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a frame encoded by MarshalBinary. The ID is formatted
+// as in JSON frames.
+func (f *Frame) UnmarshalBinary(b []byte) error {
+	if len(b) < binaryHeaderSize {
+		return errors.New("binary frame too short")
+	}
+	if b[0] != binaryVersion {
+		return fmt.Errorf("unsupported binary frame version %d", b[0])
+	}
+	flags := b[1]
+	length := int(b[2])
+	channelLen := int(b[3])
+	dataLen := length
+	if flags&binaryRTR != 0 {
+		dataLen = 0
+	}
+	if length > MaxFDDataLength || len(b) != binaryHeaderSize+channelLen+dataLen {
+		return fmt.Errorf("binary frame of %d bytes does not match its header", len(b))
+	}
+
+	*f = Frame{
+		Length:    length,
+		Timestamp: int64(binary.LittleEndian.Uint64(b[8:16])),
+		Meta:      int64(binary.LittleEndian.Uint64(b[16:24])),
+		Channel:   string(b[binaryHeaderSize : binaryHeaderSize+channelLen]),
+		Extended:  flags&binaryExtended != 0,
+		RTR:       flags&binaryRTR != 0,
+		Error:     flags&binaryError != 0,
+		FD:        flags&binaryFD != 0,
+		BRS:       flags&binaryBRS != 0,
+		ESI:       flags&binaryESI != 0,
+	}
+	f.ID = FormatID(binary.LittleEndian.Uint32(b[4:8]), f.Extended || f.Error)
+	f.Data = append([]byte(nil), b[binaryHeaderSize+channelLen:]...)
+	return nil
+}
+
+// Encode encodes a frame for the given content type.
+func Encode(f *Frame, contentType string) ([]byte, error) {
+	if contentType == ContentTypeBinary {
+		return f.MarshalBinary()
+	}
+	return json.Marshal(f)
+}
+
+// Decode decodes a frame with the content type from the message header; an
+// empty content type is JSON.
+func Decode(contentType string, data []byte, f *Frame) error {
+	switch contentType {
+	case ContentTypeBinary:
+		return f.UnmarshalBinary(data)
+	case "", ContentTypeJSON:
+		return json.Unmarshal(data, f)
+	}
+	return fmt.Errorf("unknown frame content type %q", contentType)
+}
@@ -0,0 +1,102 @@
+package canframe
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// sameFrame compares frames; an empty payload may be nil or empty.
+func sameFrame(a, b Frame) bool {
+	if !bytes.Equal(a.Data, b.Data) {
+		return false
+	}
+	a.Data, b.Data = nil, nil
+	return reflect.DeepEqual(a, b)
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	frames := map[string]Frame{
+		"standard": {ID: "6B0", Length: 8, Data: []byte{0, 0xA1, 0, 0x48, 0x6E, 0x50, 0, 0x5F}, Meta: 39, Timestamp: 1762366801123456789, Channel: "bms"},
+		"empty":    {ID: "000", Data: []byte{}, Channel: "can0"},
+		"extended": {ID: "1FFFFFF0", Length: 2, Data: []byte{1, 0x19}, Channel: "drive", Extended: true},
+		"remote":   {ID: "7DF", Length: 8, Data: []byte{}, Channel: "can0", RTR: true},
+		"ext rtr":  {ID: "18FF50E5", Length: 3, Data: []byte{}, Channel: "can0", Extended: true, RTR: true},
+		"error":    {ID: "00000004", Length: 8, Data: []byte{0, 4, 0, 0, 0, 0, 0, 0}, Channel: "can0", Error: true},
+		"fd brs":   {ID: "123", Length: 12, Data: []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, Channel: "fd", FD: true, BRS: true, ESI: true},
+	}
+	for name, f := range frames {
+		b, err := f.MarshalBinary()
+		if err != nil {
+			t.Errorf("%s: MarshalBinary: %v", name, err)
+			continue
+		}
+		var got Frame
+		if err := got.UnmarshalBinary(b); err != nil {
+			t.Errorf("%s: UnmarshalBinary: %v", name, err)
+			continue
+		}
+		if !sameFrame(got, f) {
+			t.Errorf("%s: round trip = %+v, want %+v", name, got, f)
+		}
+
+		// Encode and Decode pick the encoding by content type
+		encoded, err := Encode(&f, ContentTypeBinary)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Decode(ContentTypeBinary, encoded, &got); err != nil || !sameFrame(got, f) {
+			t.Errorf("%s: Decode = %+v, %v", name, got, err)
+		}
+		if encoded, err = Encode(&f, ContentTypeJSON); err != nil {
+			t.Fatal(err)
+		}
+		if err := Decode("", encoded, &got); err != nil || !sameFrame(got, f) {
+			t.Errorf("%s: JSON Decode = %+v, %v", name, got, err)
+		}
+	}
+}
+
+func TestMarshalBinaryInvalid(t *testing.T) {
+	for name, f := range map[string]Frame{
+		"bad ID":          {ID: "XYZ"},
+		"standard range":  {ID: "800"},
+		"length mismatch": {ID: "123", Length: 8, Data: []byte{1, 2}},
+		"too long":        {ID: "123", Length: 65, Data: make([]byte, 65)},
+		"channel name":    {ID: "123", Channel: string(make([]byte, 256))},
+	} {
+		if _, err := f.MarshalBinary(); err == nil {
+			t.Errorf("%s: MarshalBinary accepted %+v", name, f)
+		}
+	}
+}
+
+func TestUnmarshalBinaryInvalid(t *testing.T) {
+	f := Frame{ID: "6B0", Length: 2, Data: []byte{1, 2}, Channel: "bms"}
+	valid, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := func(change func(b []byte) []byte) []byte {
+		return change(append([]byte(nil), valid...))
+	}
+
+	for name, b := range map[string][]byte{
+		"empty":           nil,
+		"short header":    valid[:binaryHeaderSize-1],
+		"truncated data":  valid[:len(valid)-1],
+		"trailing byte":   append(append([]byte(nil), valid...), 0),
+		"unknown version": corrupt(func(b []byte) []byte { b[0] = 2; return b }),
+		"length":          corrupt(func(b []byte) []byte { b[2] = 3; return b }),
+		"length above 64": corrupt(func(b []byte) []byte { b[2] = 65; return b }),
+		"channel length":  corrupt(func(b []byte) []byte { b[3] = 4; return b }),
+	} {
+		var got Frame
+		if err := got.UnmarshalBinary(b); err == nil {
+			t.Errorf("%s: UnmarshalBinary accepted %x as %+v", name, b, got)
+		}
+	}
+	if err := Decode("text/plain", valid, &f); err == nil {
+		t.Error("Decode accepted an unknown content type")
+	}
+}
@@ -0,0 +1,64 @@
+// Package cansock reads classic and FD frames from a SocketCAN raw socket together
+// with the time the kernel received them. The socket asks for hardware timestamps from the
+// CAN controller and falls back to the kernel software timestamp, so the frame
+// time does not include the scheduling delay before the reader gets to run.
+package cansock
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrUnsupported is returned by Dial on platforms without SocketCAN.
+var ErrUnsupported = errors.New("cansock: SocketCAN is only available on Linux")
+
+// TimeSource tells where the receive time of a frame came from.
+type TimeSource int
+
+const (
+	// TimeHost is time.Now() after the read, used when the kernel gave no timestamp.
+	TimeHost TimeSource = iota
+	// TimeSoftware is the kernel software timestamp taken when the frame arrived.
+	TimeSoftware
+	// TimeHardware is the timestamp of the CAN controller, which the driver keeps
+	// aligned with system time.
+	TimeHardware
+	// TimeAdapter is the millisecond timestamp of a serial (slcan) adapter,
+	// anchored to system time at the first frame.
+	TimeAdapter
+)
+
+func (s TimeSource) String() string {
+	switch s {
+	case TimeSoftware:
+		return "software"
+	case TimeHardware:
+		return "hardware"
+	case TimeAdapter:
+		return "adapter"
+	}
+	return "host"
+}
+
+// Frame is one classic or FD CAN frame as read from the socket.
+type Frame struct {
+	ID         uint32 // 11 or 29-bit identifier, or the CAN_ERR_* class bits of an error frame
+	Extended   bool
+	RTR        bool
+	Error      bool
+	FD         bool
+	BRS        bool  // FD bit rate switch
+	ESI        bool  // FD error state indicator
+	Length     uint8 // payload length, for remote frames the requested length
+	Data       [64]byte
+	Time       time.Time
+	TimeSource TimeSource
+}
+
+// Payload returns the data bytes of the frame. Remote frames have none.
+func (f *Frame) Payload() []byte {
+	if f.RTR {
+		return nil
+	}
+	return f.Data[:min(int(f.Length), len(f.Data))]
+}
@@ -0,0 +1,225 @@
+//go:build linux
+
+package cansock
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	frameSize   = 16 // struct can_frame
+	fdFrameSize = 72 // struct canfd_frame
+
+	// canfd_frame.flags
+	canfdBRS = 0x01
+	canfdESI = 0x02
+
+	timestampingFlags = unix.SOF_TIMESTAMPING_RX_HARDWARE | unix.SOF_TIMESTAMPING_RAW_HARDWARE |
+		unix.SOF_TIMESTAMPING_RX_SOFTWARE | unix.SOF_TIMESTAMPING_SOFTWARE
+)
+
+// Conn is a raw CAN socket bound to one interface.
+type Conn struct {
+	file *os.File
+	raw  syscall.RawConn
+	name string
+	oob  []byte
+}
+
+// Dial opens a raw CAN socket on the named interface (e.g. "can0") with error
+// frames and receive timestamps enabled.
+func Dial(ifname string, opt ...DialOption) (*Conn, error) {
+	var opts dialOpts
+	for _, o := range opt {
+		o(&opts)
+	}
+	iface, err := net.InterfaceByName(ifname)
+	if err != nil {
+		return nil, fmt.Errorf("cansock: %w", err)
+	}
+	fd, err := unix.Socket(unix.AF_CAN, unix.SOCK_RAW|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, unix.CAN_RAW)
+	if err != nil {
+		return nil, fmt.Errorf("cansock: socket: %w", err)
+	}
+	if err := setup(fd, ifname, iface.Index, &opts); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	// The runtime poller makes reads interruptible by Close and read deadlines
+	file := os.NewFile(uintptr(fd), ifname)
+	raw, err := file.SyscallConn()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cansock: %w", err)
+	}
+	return &Conn{
+		file: file,
+		raw:  raw,
+		name: ifname,
+		oob:  make([]byte, unix.CmsgSpace(3*int(unsafe.Sizeof(unix.Timespec{})))),
+	}, nil
+}
+
+func setup(fd int, ifname string, ifindex int, opts *dialOpts) error {
+	if err := unix.SetsockoptInt(fd, unix.SOL_CAN_RAW, unix.CAN_RAW_ERR_FILTER, unix.CAN_ERR_MASK); err != nil {
+		return fmt.Errorf("cansock: enable error frames: %w", err)
+	}
+	// FD frames are only delivered on FD-capable interfaces; kernels without FD
+	// support reject the option and keep delivering classic frames.
+	_ = unix.SetsockoptInt(fd, unix.SOL_CAN_RAW, unix.CAN_RAW_FD_FRAMES, 1)
+	if len(opts.filters) > 0 {
+		if err := unix.SetsockoptCanRawFilter(fd, unix.SOL_CAN_RAW, unix.CAN_RAW_FILTER, kernelFilters(opts.filters)); err != nil {
+			return fmt.Errorf("cansock: set filters: %w", err)
+		}
+	}
+
+	// Hardware timestamps need the driver to stamp received frames; not every
+	// controller can, and changing it needs CAP_NET_ADMIN, so this is best effort.
+	_ = unix.IoctlSetHwTstamp(fd, ifname, &unix.HwTstampConfig{
+		Tx_type:   unix.HWTSTAMP_TX_OFF,
+		Rx_filter: unix.HWTSTAMP_FILTER_ALL,
+	})
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_TIMESTAMPING, timestampingFlags); err != nil {
+		if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_TIMESTAMPNS, 1); err != nil {
+			return fmt.Errorf("cansock: enable timestamps: %w", err)
+		}
+	}
+
+	if err := unix.Bind(fd, &unix.SockaddrCAN{Ifindex: ifindex}); err != nil {
+		return fmt.Errorf("cansock: bind %s: %w", ifname, err)
+	}
+	return nil
+}
+
+// ReadFrame blocks until the next frame arrives.
+func (c *Conn) ReadFrame() (Frame, error) {
+	var (
+		buf      [fdFrameSize]byte
+		n, oobn  int
+		readErr  error
+		received time.Time
+	)
+	err := c.raw.Read(func(fd uintptr) bool {
+		n, oobn, _, _, readErr = unix.Recvmsg(int(fd), buf[:], c.oob, 0)
+		return readErr != unix.EAGAIN
+	})
+	received = time.Now()
+	if err == nil {
+		err = readErr
+	}
+	if err != nil {
+		return Frame{}, fmt.Errorf("cansock: read %s: %w", c.name, err)
+	}
+	if n != frameSize && n != fdFrameSize {
+		return Frame{}, fmt.Errorf("cansock: read %s: unexpected frame size of %d bytes", c.name, n)
+	}
+
+	frame := decodeFrame(buf[:n])
+	frame.Time, frame.TimeSource = received, TimeHost
+	if ts, source, ok := parseTimestamp(c.oob[:oobn]); ok {
+		frame.Time, frame.TimeSource = ts, source
+	}
+	return frame, nil
+}
+
+// Close closes the socket and unblocks a pending ReadFrame.
+func (c *Conn) Close() error {
+	return c.file.Close()
+}
+
+// decodeFrame decodes a struct can_frame or, by its size, a struct canfd_frame
+// in host byte order.
+func decodeFrame(b []byte) Frame {
+	canID := binary.NativeEndian.Uint32(b[0:4])
+	frame := Frame{
+		Extended: canID&unix.CAN_EFF_FLAG != 0,
+		RTR:      canID&unix.CAN_RTR_FLAG != 0,
+		Error:    canID&unix.CAN_ERR_FLAG != 0,
+		FD:       len(b) == fdFrameSize,
+		Length:   b[4],
+	}
+	if frame.FD {
+		// FD frames have no remote variant; the length is already in bytes
+		frame.BRS = b[5]&canfdBRS != 0
+		frame.ESI = b[5]&canfdESI != 0
+		frame.RTR = false
+	}
+	copy(frame.Data[:], b[8:])
+	switch {
+	case frame.Error:
+		frame.ID = canID & unix.CAN_ERR_MASK
+		frame.Extended, frame.RTR = false, false
+	case frame.Extended:
+		frame.ID = canID & unix.CAN_EFF_MASK
+	default:
+		frame.ID = canID & unix.CAN_SFF_MASK
+	}
+	return frame
+}
+
+// kernelFilters converts filters to struct can_filter. The EFF flag is part of
+// the mask so a filter only matches its own frame format.
+func kernelFilters(filters []Filter) []unix.CanFilter {
+	out := make([]unix.CanFilter, len(filters))
+	for i, f := range filters {
+		id, mask := f.ID&unix.CAN_SFF_MASK, f.Mask&unix.CAN_SFF_MASK
+		if f.Extended {
+			id, mask = f.ID&unix.CAN_EFF_MASK|unix.CAN_EFF_FLAG, f.Mask&unix.CAN_EFF_MASK
+		}
+		out[i] = unix.CanFilter{Id: id, Mask: mask | unix.CAN_EFF_FLAG}
+	}
+	return out
+}
+
+// parseTimestamp picks the best receive timestamp from the control messages:
+// the hardware time when the controller provided one, else the software time.
+func parseTimestamp(oob []byte) (time.Time, TimeSource, bool) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return time.Time{}, TimeHost, false
+	}
+	size := int(unsafe.Sizeof(unix.Timespec{}))
+	for _, msg := range msgs {
+		if msg.Header.Level != unix.SOL_SOCKET {
+			continue
+		}
+		switch msg.Header.Type {
+		case unix.SO_TIMESTAMPING:
+			// ts[0] is the software, ts[2] the raw hardware timestamp
+			if len(msg.Data) < 3*size {
+				continue
+			}
+			if hw := readTimespec(msg.Data[2*size:]); !hw.IsZero() {
+				return hw, TimeHardware, true
+			}
+			if sw := readTimespec(msg.Data); !sw.IsZero() {
+				return sw, TimeSoftware, true
+			}
+		case unix.SO_TIMESTAMPNS:
+			if len(msg.Data) < size {
+				continue
+			}
+			if sw := readTimespec(msg.Data); !sw.IsZero() {
+				return sw, TimeSoftware, true
+			}
+		}
+	}
+	return time.Time{}, TimeHost, false
+}
+
+func readTimespec(b []byte) time.Time {
+	ts := *(*unix.Timespec)(unsafe.Pointer(&b[0]))
+	if ts.Sec == 0 && ts.Nsec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(ts.Unix())
+}
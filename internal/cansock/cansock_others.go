@@ -0,0 +1,31 @@
+//go:build !linux
+
+package cansock
+
+// Conn is a raw CAN socket bound to one interface.
+type Conn struct{}
+
+// Dial always fails outside Linux.
+func Dial(ifname string, opt ...DialOption) (*Conn, error) {
+	return nil, ErrUnsupported
+}
+
+// ReadFrame always fails outside Linux.
+func (c *Conn) ReadFrame() (Frame, error) {
+	return Frame{}, ErrUnsupported
+}
+
+// Close does nothing outside Linux.
+func (c *Conn) Close() error {
+	return nil
+}
+
+// GetLinkStatus always fails outside Linux.
+func GetLinkStatus(ifname string) (LinkStatus, error) {
+	return LinkStatus{}, ErrUnsupported
+}
+
+// SetLinkUp always fails outside Linux.
+func SetLinkUp(ifname string, up bool) error {
+	return ErrUnsupported
+}
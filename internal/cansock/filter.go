@@ -0,0 +1,44 @@
+package cansock
+
+// Filter accepts frames whose identifier matches ID in the bits set in Mask,
+// like a SocketCAN struct can_filter. A filter matches either standard or
+// extended frames, never both; error frames are not affected by filters.
+type Filter struct {
+	ID       uint32
+	Mask     uint32
+	Extended bool
+}
+
+// Match reports whether the filter accepts a frame.
+func (f Filter) Match(id uint32, extended bool) bool {
+	return extended == f.Extended && id&f.Mask == f.ID&f.Mask
+}
+
+// MatchAny reports whether any filter accepts the frame. An empty list accepts
+// every frame, as does any list for error frames.
+func MatchAny(filters []Filter, frame *Frame) bool {
+	if len(filters) == 0 || frame.Error {
+		return true
+	}
+	for _, f := range filters {
+		if f.Match(frame.ID, frame.Extended) {
+			return true
+		}
+	}
+	return false
+}
+
+// DialOption configures a socket opened by Dial.
+type DialOption func(*dialOpts)
+
+type dialOpts struct {
+	filters []Filter
+}
+
+// WithFilters installs the filters in the kernel, so frames no filter accepts
+// are dropped before they reach the reader. Without filters every frame is received.
+func WithFilters(filters ...Filter) DialOption {
+	return func(o *dialOpts) {
+		o.filters = append(o.filters, filters...)
+	}
+}
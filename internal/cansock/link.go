@@ -0,0 +1,97 @@
+package cansock
+
+// BusState is the error state of a CAN controller (enum can_state).
+type BusState uint32
+
+const (
+	StateErrorActive  BusState = 0 // error counters below 96
+	StateErrorWarning BusState = 1 // an error counter reached 96
+	StateErrorPassive BusState = 2 // an error counter reached 128
+	StateBusOff       BusState = 3 // the transmit error counter passed 255
+	StateStopped      BusState = 4 // the interface is down
+	StateSleeping     BusState = 5
+)
+
+func (s BusState) String() string {
+	switch s {
+	case StateErrorActive:
+		return "error_active"
+	case StateErrorWarning:
+		return "error_warning"
+	case StateErrorPassive:
+		return "error_passive"
+	case StateBusOff:
+		return "bus_off"
+	case StateStopped:
+		return "stopped"
+	case StateSleeping:
+		return "sleeping"
+	}
+	return "unknown"
+}
+
+// LinkStatus is the state of a CAN interface as reported by rtnetlink.
+type LinkStatus struct {
+	Up       bool
+	State    BusState
+	TxErrors uint16 // transmit error counter
+	RxErrors uint16 // receive error counter
+	Stats    DeviceStats
+}
+
+// DeviceStats are the cumulative CAN controller statistics (struct can_device_stats).
+type DeviceStats struct {
+	BusErrors       uint32
+	ErrorWarning    uint32 // transitions to error warning
+	ErrorPassive    uint32 // transitions to error passive
+	BusOff          uint32 // transitions to bus off
+	ArbitrationLost uint32
+	Restarts        uint32 // controller restarts
+}
+
+// Error frame classes and details from linux/can/error.h used to follow the bus
+// state without polling.
+const (
+	ErrClassCtrl      = 0x00000004 // controller problem, details in Data[1]
+	ErrClassBusOff    = 0x00000040
+	ErrClassRestarted = 0x00000100
+	ErrClassCounters  = 0x00000200 // Data[6] and Data[7] hold the TX and RX error counters
+
+	ErrCtrlRxWarning = 0x04
+	ErrCtrlTxWarning = 0x08
+	ErrCtrlRxPassive = 0x10
+	ErrCtrlTxPassive = 0x20
+	ErrCtrlActive    = 0x40
+)
+
+// ErrorFrameState returns the bus state an error frame reports, if any.
+func ErrorFrameState(f *Frame) (BusState, bool) {
+	if !f.Error {
+		return 0, false
+	}
+	switch {
+	case f.ID&ErrClassBusOff != 0:
+		return StateBusOff, true
+	case f.ID&ErrClassRestarted != 0:
+		return StateErrorActive, true
+	case f.ID&ErrClassCtrl != 0:
+		ctrl := f.Data[1]
+		switch {
+		case ctrl&(ErrCtrlRxPassive|ErrCtrlTxPassive) != 0:
+			return StateErrorPassive, true
+		case ctrl&(ErrCtrlRxWarning|ErrCtrlTxWarning) != 0:
+			return StateErrorWarning, true
+		case ctrl&ErrCtrlActive != 0:
+			return StateErrorActive, true
+		}
+	}
+	return 0, false
+}
+
+// ErrorFrameCounters returns the TX and RX error counters carried by an error frame.
+func ErrorFrameCounters(f *Frame) (tx, rx uint16, ok bool) {
+	if !f.Error || f.ID&ErrClassCounters == 0 {
+		return 0, 0, false
+	}
+	return uint16(f.Data[6]), uint16(f.Data[7]), true
+}
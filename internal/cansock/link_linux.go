@@ -0,0 +1,146 @@
+//go:build linux
+
+package cansock
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// GetLinkStatus reads the up flag, bus state, error counters and controller
+// statistics of a CAN interface.
+func GetLinkStatus(ifname string) (LinkStatus, error) {
+	iface, err := net.InterfaceByName(ifname)
+	if err != nil {
+		return LinkStatus{}, fmt.Errorf("cansock: %w", err)
+	}
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETLINK, syscall.AF_UNSPEC)
+	if err != nil {
+		return LinkStatus{}, fmt.Errorf("cansock: netlink: %w", err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return LinkStatus{}, fmt.Errorf("cansock: netlink: %w", err)
+	}
+
+	for _, msg := range msgs {
+		if msg.Header.Type != syscall.RTM_NEWLINK || len(msg.Data) < unix.SizeofIfInfomsg {
+			continue
+		}
+		info := (*unix.IfInfomsg)(unsafe.Pointer(&msg.Data[0]))
+		if int(info.Index) != iface.Index {
+			continue
+		}
+
+		// vcan and other virtual interfaces report no state and are always active
+		status := LinkStatus{Up: info.Flags&unix.IFF_UP != 0, State: StateErrorActive}
+		linkInfo := parseAttrs(msg.Data[unix.SizeofIfInfomsg:])[unix.IFLA_LINKINFO]
+		attrs := parseAttrs(linkInfo)
+		data := parseAttrs(attrs[unix.IFLA_INFO_DATA])
+		if b := data[unix.IFLA_CAN_STATE]; len(b) >= 4 {
+			status.State = BusState(binary.NativeEndian.Uint32(b))
+		}
+		if b := data[unix.IFLA_CAN_BERR_COUNTER]; len(b) >= 4 {
+			status.TxErrors = binary.NativeEndian.Uint16(b[0:2])
+			status.RxErrors = binary.NativeEndian.Uint16(b[2:4])
+		}
+		if b := attrs[unix.IFLA_INFO_XSTATS]; len(b) >= 24 {
+			status.Stats = DeviceStats{
+				BusErrors:       binary.NativeEndian.Uint32(b[0:4]),
+				ErrorWarning:    binary.NativeEndian.Uint32(b[4:8]),
+				ErrorPassive:    binary.NativeEndian.Uint32(b[8:12]),
+				BusOff:          binary.NativeEndian.Uint32(b[12:16]),
+				ArbitrationLost: binary.NativeEndian.Uint32(b[16:20]),
+				Restarts:        binary.NativeEndian.Uint32(b[20:24]),
+			}
+		}
+		if !status.Up {
+			status.State = StateStopped
+		}
+		return status, nil
+	}
+	return LinkStatus{}, fmt.Errorf("cansock: %s not found in netlink link list", ifname)
+}
+
+// parseAttrs splits a block of netlink attributes by type. Nested attributes
+// are returned as their raw payload for another parseAttrs call.
+func parseAttrs(b []byte) map[uint16][]byte {
+	attrs := make(map[uint16][]byte)
+	for len(b) >= unix.SizeofRtAttr {
+		length := int(binary.NativeEndian.Uint16(b[0:2]))
+		typ := binary.NativeEndian.Uint16(b[2:4]) &^ unix.NLA_F_NESTED
+		if length < unix.SizeofRtAttr || length > len(b) {
+			break
+		}
+		attrs[typ] = b[unix.SizeofRtAttr:length]
+		aligned := (length + unix.NLA_ALIGNTO - 1) &^ (unix.NLA_ALIGNTO - 1)
+		if aligned > len(b) {
+			break
+		}
+		b = b[aligned:]
+	}
+	return attrs
+}
+
+// SetLinkUp brings a CAN interface up or down. Cycling the link resets the
+// controller out of bus-off; it needs CAP_NET_ADMIN.
+func SetLinkUp(ifname string, up bool) error {
+	iface, err := net.InterfaceByName(ifname)
+	if err != nil {
+		return fmt.Errorf("cansock: %w", err)
+	}
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return fmt.Errorf("cansock: netlink socket: %w", err)
+	}
+	defer unix.Close(fd)
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return fmt.Errorf("cansock: netlink bind: %w", err)
+	}
+
+	var flags uint32
+	if up {
+		flags = unix.IFF_UP
+	}
+	req := make([]byte, unix.SizeofNlMsghdr+unix.SizeofIfInfomsg)
+	*(*unix.NlMsghdr)(unsafe.Pointer(&req[0])) = unix.NlMsghdr{
+		Len:   uint32(len(req)),
+		Type:  unix.RTM_NEWLINK,
+		Flags: unix.NLM_F_REQUEST | unix.NLM_F_ACK,
+		Seq:   1,
+	}
+	*(*unix.IfInfomsg)(unsafe.Pointer(&req[unix.SizeofNlMsghdr])) = unix.IfInfomsg{
+		Family: unix.AF_UNSPEC,
+		Index:  int32(iface.Index),
+		Flags:  flags,
+		Change: unix.IFF_UP,
+	}
+	if err := unix.Sendto(fd, req, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return fmt.Errorf("cansock: set %s up=%v: %w", ifname, up, err)
+	}
+
+	buf := make([]byte, 4096)
+	n, _, err := unix.Recvfrom(fd, buf, 0)
+	if err != nil {
+		return fmt.Errorf("cansock: set %s up=%v: %w", ifname, up, err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+	if err != nil {
+		return fmt.Errorf("cansock: set %s up=%v: %w", ifname, up, err)
+	}
+	for _, msg := range msgs {
+		if msg.Header.Type != unix.NLMSG_ERROR || len(msg.Data) < 4 {
+			continue
+		}
+		if errno := -int32(binary.NativeEndian.Uint32(msg.Data[0:4])); errno != 0 {
+			return fmt.Errorf("cansock: set %s up=%v: %w", ifname, up, syscall.Errno(errno))
+		}
+		return nil
+	}
+	return fmt.Errorf("cansock: set %s up=%v: no netlink acknowledgement", ifname, up)
+}
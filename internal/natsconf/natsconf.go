@@ -0,0 +1,158 @@
+// Package natsconf builds the NATS connection of every service from the shared
+// nats section of config.yaml: server URLs, credentials, TLS, client name and
+// reconnect policy. Without the section the services connect to
+// nats://127.0.0.1:4222 without authentication, as they always did.
+package natsconf
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/spf13/viper"
+)
+
+// Config is the nats section of the configuration.
+type Config struct {
+	URLs     []string // servers, tried in order
+	Name     string   // client name shown by the server, "<name>-<service>"
+	User     string
+	Password string
+	Token    string
+	// CredsFile is a .creds file with a user JWT and nkey seed (NGS, operator mode).
+	CredsFile string
+	// NKeyFile is a file with a plain nkey seed.
+	NKeyFile string
+
+	TLSCAFile   string
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSInsecure skips verification of the server certificate; for testing only.
+	TLSInsecure bool
+
+	ConnectTimeout       time.Duration
+	MaxReconnects        int // -1 retries forever
+	ReconnectWait        time.Duration
+	RetryOnFailedConnect bool // keep trying in the background when the first connect fails
+}
+
+// Load reads the nats section of the viper configuration for the named service.
+func Load(service string) (Config, error) {
+	viper.SetDefault("nats.urls", []string{nats.DefaultURL})
+	viper.SetDefault("nats.name", "wecan")
+	viper.SetDefault("nats.connect_timeout", nats.DefaultTimeout)
+	viper.SetDefault("nats.reconnect.max_reconnects", -1)
+	viper.SetDefault("nats.reconnect.wait", nats.DefaultReconnectWait)
+	viper.SetDefault("nats.reconnect.retry_on_failed_connect", false)
+
+	cfg := Config{
+		URLs:                 viper.GetStringSlice("nats.urls"),
+		Name:                 viper.GetString("nats.name"),
+		User:                 viper.GetString("nats.user"),
+		Password:             viper.GetString("nats.password"),
+		Token:                viper.GetString("nats.token"),
+		CredsFile:            viper.GetString("nats.credentials"),
+		NKeyFile:             viper.GetString("nats.nkey"),
+		TLSCAFile:            viper.GetString("nats.tls.ca"),
+		TLSCertFile:          viper.GetString("nats.tls.cert"),
+		TLSKeyFile:           viper.GetString("nats.tls.key"),
+		TLSInsecure:          viper.GetBool("nats.tls.insecure"),
+		ConnectTimeout:       viper.GetDuration("nats.connect_timeout"),
+		MaxReconnects:        viper.GetInt("nats.reconnect.max_reconnects"),
+		ReconnectWait:        viper.GetDuration("nats.reconnect.wait"),
+		RetryOnFailedConnect: viper.GetBool("nats.reconnect.retry_on_failed_connect"),
+	}
+	if cfg.Name != "" && service != "" {
+		cfg.Name += "-" + service
+	}
+
+	if len(cfg.URLs) == 0 {
+		return cfg, fmt.Errorf("nats.urls must list at least one server")
+	}
+	auth := 0
+	for _, set := range []bool{cfg.User != "", cfg.Token != "", cfg.CredsFile != "", cfg.NKeyFile != ""} {
+		if set {
+			auth++
+		}
+	}
+	if auth > 1 {
+		return cfg, fmt.Errorf("nats: set only one of user, token, credentials and nkey")
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return cfg, fmt.Errorf("nats.tls: cert and key must be set together")
+	}
+	if cfg.ConnectTimeout <= 0 || cfg.ReconnectWait <= 0 {
+		return cfg, fmt.Errorf("nats: connect_timeout and reconnect.wait must be positive")
+	}
+	return cfg, nil
+}
+
+// Servers returns the server URLs as the comma-separated list nats.Connect takes.
+func (c Config) Servers() string {
+	return strings.Join(c.URLs, ",")
+}
+
+// Options returns the connection options for the configuration.
+func (c Config) Options() ([]nats.Option, error) {
+	opts := []nats.Option{
+		nats.Timeout(c.ConnectTimeout),
+		nats.MaxReconnects(c.MaxReconnects),
+		nats.ReconnectWait(c.ReconnectWait),
+	}
+	if c.Name != "" {
+		opts = append(opts, nats.Name(c.Name))
+	}
+	if c.RetryOnFailedConnect {
+		opts = append(opts, nats.RetryOnFailedConnect(true))
+	}
+
+	switch {
+	case c.User != "":
+		opts = append(opts, nats.UserInfo(c.User, c.Password))
+	case c.Token != "":
+		opts = append(opts, nats.Token(c.Token))
+	case c.CredsFile != "":
+		opts = append(opts, nats.UserCredentials(c.CredsFile))
+	case c.NKeyFile != "":
+		opt, err := nats.NkeyOptionFromSeed(c.NKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("nats.nkey: %w", err)
+		}
+		opts = append(opts, opt)
+	}
+
+	if c.TLSInsecure {
+		opts = append(opts, nats.Secure(&tls.Config{InsecureSkipVerify: true}))
+	}
+	if c.TLSCAFile != "" {
+		opts = append(opts, nats.RootCAs(c.TLSCAFile))
+	}
+	if c.TLSCertFile != "" {
+		opts = append(opts, nats.ClientCert(c.TLSCertFile, c.TLSKeyFile))
+	}
+	return opts, nil
+}
+
+// Connect connects with the configured options followed by extra, which take
+// precedence.
+func (c Config) Connect(extra ...nats.Option) (*nats.Conn, error) {
+	opts, err := c.Options()
+	if err != nil {
+		return nil, err
+	}
+	return nats.Connect(c.Servers(), append(opts, extra...)...)
+}
+
+// Close flushes everything published on the connection, waiting at most
+// timeout for the server, and closes it. Unlike Drain it returns only once the
+// connection is closed, so it can run right before the program exits.
+func Close(nc *nats.Conn, timeout time.Duration) error {
+	var err error
+	if nc.IsConnected() {
+		err = nc.FlushTimeout(timeout)
+	}
+	nc.Close()
+	return err
+}
@@ -0,0 +1,70 @@
+package natsconf
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/spf13/viper"
+)
+
+// LoadStream reads nats.stream, the JetStream stream that keeps the raw frames,
+// and returns its configuration for the given subjects. The defaults keep the
+// original stream: CAN, file storage, 60 seconds of frames.
+func LoadStream(subjects ...string) (*nats.StreamConfig, error) {
+	viper.SetDefault("nats.stream.name", "CAN")
+	viper.SetDefault("nats.stream.storage", "file")
+	viper.SetDefault("nats.stream.max_age", 60*time.Second)
+	viper.SetDefault("nats.stream.max_bytes", 0)
+	viper.SetDefault("nats.stream.max_msgs", 0)
+	viper.SetDefault("nats.stream.replicas", 1)
+
+	cfg := &nats.StreamConfig{
+		Name:     viper.GetString("nats.stream.name"),
+		Subjects: subjects,
+		MaxAge:   viper.GetDuration("nats.stream.max_age"),
+		MaxBytes: int64(viper.GetSizeInBytes("nats.stream.max_bytes")),
+		MaxMsgs:  viper.GetInt64("nats.stream.max_msgs"),
+		Replicas: viper.GetInt("nats.stream.replicas"),
+		Discard:  nats.DiscardOld,
+	}
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("nats.stream.name is required")
+	}
+	switch storage := viper.GetString("nats.stream.storage"); storage {
+	case "file":
+		cfg.Storage = nats.FileStorage
+	case "memory":
+		cfg.Storage = nats.MemoryStorage
+	default:
+		return nil, fmt.Errorf("nats.stream.storage must be file or memory, got %q", storage)
+	}
+	if cfg.MaxAge < 0 || cfg.MaxMsgs < 0 || cfg.Replicas < 1 {
+		return nil, fmt.Errorf("nats.stream: max_age and max_msgs must not be negative and replicas must be at least 1")
+	}
+	// Zero means unlimited in the config file, -1 to the server
+	if cfg.MaxBytes == 0 {
+		cfg.MaxBytes = -1
+	}
+	if cfg.MaxMsgs == 0 {
+		cfg.MaxMsgs = -1
+	}
+	if cfg.MaxAge == 0 && cfg.MaxBytes < 0 && cfg.MaxMsgs < 0 {
+		return nil, fmt.Errorf("nats.stream: set at least one of max_age, max_bytes and max_msgs")
+	}
+	return cfg, nil
+}
+
+// EnsureStream creates the stream, or updates it when it already exists with
+// other limits. The storage type of an existing stream cannot be changed.
+func EnsureStream(js nats.JetStreamContext, cfg *nats.StreamConfig) error {
+	_, err := js.AddStream(cfg)
+	if errors.Is(err, nats.ErrStreamNameAlreadyInUse) {
+		_, err = js.UpdateStream(cfg)
+	}
+	if err != nil {
+		return fmt.Errorf("stream %s: %w", cfg.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package natsconf
+
+import (
+	"fmt"
+
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/canframe"
+	"github.com/spf13/viper"
+)
+
+// RawSubject is the root of the raw frame subjects, see FrameSubject.
+const RawSubject = "can.raw"
+
+// Subject layouts of reader.subjects.
+const (
+	SubjectsRaw     = "raw"     // everything on can.raw, for older consumers
+	SubjectsChannel = "channel" // can.raw.<channel>
+	SubjectsID      = "id"      // can.raw.<channel>.<id>
+)
+
+// LoadSubjectLayout reads reader.subjects. Without it frames go to
+// can.raw.<channel>.<id>, or can.raw.<channel> when the older
+// reader.per_channel_subjects is set.
+func LoadSubjectLayout() (string, error) {
+	layout := viper.GetString("reader.subjects")
+	if layout == "" {
+		if viper.GetBool("reader.per_channel_subjects") {
+			return SubjectsChannel, nil
+		}
+		return SubjectsID, nil
+	}
+	switch layout {
+	case SubjectsRaw, SubjectsChannel, SubjectsID:
+		return layout, nil
+	}
+	return "", fmt.Errorf("reader.subjects must be raw, channel or id, got %q", layout)
+}
+
+// FrameSubject returns the subject a frame is published on. In the id layout
+// the last token is the ID as in the frame ("351", "18FF50E5"), or "error" for
+// error frames. Frames without a channel, from captures of older readers, go
+// to can.raw in every layout.
+func FrameSubject(layout string, f *canframe.Frame) string {
+	if f.Channel == "" {
+		return RawSubject
+	}
+	switch layout {
+	case SubjectsChannel:
+		return RawSubject + "." + f.Channel
+	case SubjectsID:
+		id := f.ID
+		if f.Error {
+			id = "error"
+		}
+		return RawSubject + "." + f.Channel + "." + id
+	}
+	return RawSubject
+}
@@ -0,0 +1,30 @@
+package natsconf
+
+import (
+	"testing"
+
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/canframe"
+)
+
+func TestFrameSubject(t *testing.T) {
+	frame := &canframe.Frame{Channel: "bms", ID: "351"}
+	errFrame := &canframe.Frame{Channel: "bms", ID: "020", Error: true}
+	legacy := &canframe.Frame{ID: "351"} // capture without a channel
+	tests := []struct {
+		layout string
+		frame  *canframe.Frame
+		want   string
+	}{
+		{SubjectsID, frame, "can.raw.bms.351"},
+		{SubjectsID, errFrame, "can.raw.bms.error"},
+		{SubjectsID, legacy, "can.raw"},
+		{SubjectsChannel, frame, "can.raw.bms"},
+		{SubjectsChannel, legacy, "can.raw"},
+		{SubjectsRaw, frame, "can.raw"},
+	}
+	for _, tt := range tests {
+		if got := FrameSubject(tt.layout, tt.frame); got != tt.want {
+			t.Errorf("FrameSubject(%s, %+v) = %s, want %s", tt.layout, tt.frame, got, tt.want)
+		}
+	}
+}
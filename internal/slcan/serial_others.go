@@ -0,0 +1,15 @@
+//go:build !linux
+
+package slcan
+
+import "os"
+
+// syscallNoCtty is not needed where the line settings are left alone.
+const syscallNoCtty = 0
+
+// configureSerial leaves the line settings as they are; set raw mode and the
+// speed with stty before starting the reader. USB-CDC adapters and
+// pseudo-terminals work without.
+func configureSerial(file *os.File, baud int) error {
+	return nil
+}
@@ -0,0 +1,392 @@
+// Package slcan talks to serial CAN adapters that speak the LAWICEL (slcan)
+// ASCII protocol, such as CANable, CANUSB and USBtin, directly over their
+// serial or USB-CDC device, without slcand. It also works on a pseudo-terminal,
+// so an adapter can be simulated by a program on the other end.
+//
+// Frames are exchanged as lines ending in '\r': t<iii><l><data> for standard
+// and T<iiiiiiii><l><data> for extended frames, r and R for remote frames and
+// d, D, b and B for CAN FD frames (b and B with bit rate switch). With
+// timestamps enabled the adapter appends four hex digits of milliseconds,
+// wrapping every 60 seconds.
+package slcan
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/canframe"
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/cansock"
+)
+
+// commandTimeout bounds the wait for the adapter to answer a setup command.
+const commandTimeout = time.Second
+
+// bitrateCodes are the arguments of the S command.
+var bitrateCodes = map[int]byte{
+	10000:   '0',
+	20000:   '1',
+	50000:   '2',
+	100000:  '3',
+	125000:  '4',
+	250000:  '5',
+	500000:  '6',
+	800000:  '7',
+	1000000: '8',
+}
+
+// ErrCommand is returned when the adapter rejects a command with BEL.
+var ErrCommand = errors.New("slcan: adapter rejected command")
+
+// Option configures Open.
+type Option func(*options)
+
+type options struct {
+	baud       int
+	bitrate    int
+	listenOnly bool
+	timestamps bool
+}
+
+// WithBaudRate sets the serial line speed. USB-CDC adapters ignore it; the
+// default is 115200.
+func WithBaudRate(baud int) Option {
+	return func(o *options) { o.baud = baud }
+}
+
+// WithBitrate sets the CAN bitrate, one of 10k, 20k, 50k, 100k, 125k, 250k,
+// 500k, 800k and 1M. The default is 500k.
+func WithBitrate(bitrate int) Option {
+	return func(o *options) { o.bitrate = bitrate }
+}
+
+// WithListenOnly opens the channel in listen-only mode, in which the adapter
+// neither acknowledges frames nor transmits.
+func WithListenOnly() Option {
+	return func(o *options) { o.listenOnly = true }
+}
+
+// WithoutTimestamps leaves the adapter timestamps off; frames are then stamped
+// with the host time when they are read.
+func WithoutTimestamps() Option {
+	return func(o *options) { o.timestamps = false }
+}
+
+// Conn is an open slcan channel.
+type Conn struct {
+	file   *os.File
+	reader *bufio.Reader
+	name   string
+	clock  adapterClock
+
+	wmu sync.Mutex // serialises commands and transmitted frames
+}
+
+// Open opens the adapter on device, sets it up and opens the CAN channel.
+func Open(device string, opt ...Option) (*Conn, error) {
+	opts := options{baud: 115200, bitrate: 500000, timestamps: true}
+	for _, o := range opt {
+		o(&opts)
+	}
+	code, ok := bitrateCodes[opts.bitrate]
+	if !ok {
+		return nil, fmt.Errorf("slcan: unsupported bitrate %d", opts.bitrate)
+	}
+
+	file, err := os.OpenFile(device, os.O_RDWR|syscallNoCtty, 0)
+	if err != nil {
+		return nil, fmt.Errorf("slcan: %w", err)
+	}
+	if err := configureSerial(file, opts.baud); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("slcan: %s: %w", device, err)
+	}
+	c := &Conn{file: file, reader: bufio.NewReader(file), name: device}
+	if err := c.setup(code, opts); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("slcan: %s: %w", device, err)
+	}
+	return c, nil
+}
+
+// setup clears whatever the adapter had buffered, closes the channel in case a
+// previous run left it open, then sets the bitrate and opens it.
+func (c *Conn) setup(bitrate byte, opts options) error {
+	if _, err := c.file.Write([]byte("\r\r\r")); err != nil {
+		return err
+	}
+	c.discardInput()
+	_ = c.command("C") // rejected when the channel is already closed
+
+	if err := c.command("S" + string(bitrate)); err != nil {
+		return fmt.Errorf("setting bitrate: %w", err)
+	}
+	if opts.timestamps {
+		if err := c.command("Z1"); err != nil {
+			return fmt.Errorf("enabling timestamps: %w", err)
+		}
+	} else {
+		_ = c.command("Z0")
+	}
+	open := "O"
+	if opts.listenOnly {
+		open = "L"
+	}
+	if err := c.command(open); err != nil {
+		return fmt.Errorf("opening channel: %w", err)
+	}
+	return c.file.SetReadDeadline(time.Time{})
+}
+
+// discardInput drops input until the adapter has been quiet for a moment.
+func (c *Conn) discardInput() {
+	buf := make([]byte, 256)
+	for {
+		if err := c.file.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+			return
+		}
+		if _, err := c.file.Read(buf); err != nil {
+			break
+		}
+	}
+	c.reader.Reset(c.file)
+}
+
+// command sends a setup command and waits for the adapter to accept it with
+// '\r' or reject it with BEL. It is only used while the channel is closed, so
+// no frames arrive in between.
+func (c *Conn) command(cmd string) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if _, err := c.file.Write([]byte(cmd + "\r")); err != nil {
+		return err
+	}
+	if err := c.file.SetReadDeadline(time.Now().Add(commandTimeout)); err != nil {
+		return err
+	}
+	for {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return fmt.Errorf("%s: no answer: %w", cmd, err)
+		}
+		switch b {
+		case '\r':
+			return nil
+		case '\a':
+			return fmt.Errorf("%s: %w", cmd, ErrCommand)
+		}
+	}
+}
+
+// Name returns the device the adapter was opened on.
+func (c *Conn) Name() string {
+	return c.name
+}
+
+// ReadFrame blocks until the next frame arrives. Answers to transmitted frames
+// and other replies of the adapter are skipped.
+func (c *Conn) ReadFrame() (cansock.Frame, error) {
+	for {
+		line, err := c.reader.ReadSlice('\r')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue // garbage, resynchronise on the next '\r'
+		}
+		if err != nil {
+			return cansock.Frame{}, fmt.Errorf("slcan: %s: %w", c.name, err)
+		}
+		now := time.Now()
+		// A BEL of a rejected transmit can precede the next line
+		line = bytes.TrimLeft(bytes.TrimSuffix(line, []byte("\r")), "\a")
+		if len(line) == 0 {
+			continue
+		}
+		switch line[0] {
+		case 't', 'T', 'r', 'R', 'd', 'D', 'b', 'B':
+		default:
+			continue // z/Z transmit acknowledgements, version and status replies
+		}
+
+		frame, ms, stamped, err := ParseFrame(line)
+		if err != nil {
+			continue // a corrupted line
+		}
+		frame.Time, frame.TimeSource = now, cansock.TimeHost
+		if stamped {
+			frame.Time, frame.TimeSource = c.clock.at(ms, now), cansock.TimeAdapter
+		}
+		return frame, nil
+	}
+}
+
+// WriteFrame transmits a frame. The channel must not be in listen-only mode.
+// Error frames cannot be sent.
+func (c *Conn) WriteFrame(f *cansock.Frame) error {
+	line, err := FormatFrame(f)
+	if err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if _, err := c.file.Write(append(line, '\r')); err != nil {
+		return fmt.Errorf("slcan: %s: %w", c.name, err)
+	}
+	return nil
+}
+
+// SetReadDeadline sets a deadline for ReadFrame.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.file.SetReadDeadline(t)
+}
+
+// Close closes the CAN channel of the adapter and the device. A ReadFrame
+// blocked in another goroutine returns an error.
+func (c *Conn) Close() error {
+	c.wmu.Lock()
+	_, _ = c.file.Write([]byte("C\r"))
+	c.wmu.Unlock()
+	return c.file.Close()
+}
+
+// ParseFrame parses one frame line without the trailing '\r'. It returns the
+// adapter timestamp in milliseconds when the line carries one.
+func ParseFrame(line []byte) (frame cansock.Frame, ms uint16, stamped bool, err error) {
+	if len(line) == 0 {
+		return frame, 0, false, errors.New("slcan: empty line")
+	}
+	idLen := 3
+	switch line[0] {
+	case 't':
+	case 'T':
+		frame.Extended, idLen = true, 8
+	case 'r':
+		frame.RTR = true
+	case 'R':
+		frame.Extended, frame.RTR, idLen = true, true, 8
+	case 'd':
+		frame.FD = true
+	case 'D':
+		frame.Extended, frame.FD, idLen = true, true, 8
+	case 'b':
+		frame.FD, frame.BRS = true, true
+	case 'B':
+		frame.Extended, frame.FD, frame.BRS, idLen = true, true, true, 8
+	default:
+		return frame, 0, false, fmt.Errorf("slcan: unknown frame type %q", line[0])
+	}
+	if len(line) < 2+idLen {
+		return frame, 0, false, fmt.Errorf("slcan: frame line %q too short", line)
+	}
+
+	id, err := strconv.ParseUint(string(line[1:1+idLen]), 16, 32)
+	if err != nil || (!frame.Extended && id > canframe.MaxStandardID) || id > canframe.MaxExtendedID {
+		return frame, 0, false, fmt.Errorf("slcan: invalid CAN ID in %q", line)
+	}
+	frame.ID = uint32(id)
+	dlc, err := strconv.ParseUint(string(line[1+idLen:2+idLen]), 16, 8)
+	if err != nil || (!frame.FD && dlc > 8) {
+		return frame, 0, false, fmt.Errorf("slcan: invalid length in %q", line)
+	}
+	length := canframe.DLCToLength(uint8(dlc), frame.FD)
+	frame.Length = uint8(length)
+
+	rest := line[2+idLen:]
+	if !frame.RTR {
+		if len(rest) < 2*length {
+			return frame, 0, false, fmt.Errorf("slcan: data shorter than length %d in %q", length, line)
+		}
+		for i := 0; i < length; i++ {
+			b, err := strconv.ParseUint(string(rest[2*i:2*i+2]), 16, 8)
+			if err != nil {
+				return frame, 0, false, fmt.Errorf("slcan: invalid data in %q", line)
+			}
+			frame.Data[i] = byte(b)
+		}
+		rest = rest[2*length:]
+	}
+
+	switch len(rest) {
+	case 0:
+		return frame, 0, false, nil
+	case 4:
+		ts, err := strconv.ParseUint(string(rest), 16, 16)
+		if err != nil {
+			return frame, 0, false, fmt.Errorf("slcan: invalid timestamp in %q", line)
+		}
+		return frame, uint16(ts), true, nil
+	}
+	return frame, 0, false, fmt.Errorf("slcan: trailing characters in %q", line)
+}
+
+// FormatFrame formats a frame as the line that transmits it, without the
+// trailing '\r'.
+func FormatFrame(f *cansock.Frame) ([]byte, error) {
+	if f.Error {
+		return nil, errors.New("slcan: error frames cannot be transmitted")
+	}
+	length := int(f.Length)
+	if !canframe.ValidLength(length, f.FD) || (f.RTR && f.FD) {
+		return nil, fmt.Errorf("slcan: invalid length %d", length)
+	}
+
+	var kind byte
+	switch {
+	case f.RTR:
+		kind = 'r'
+	case f.FD && f.BRS:
+		kind = 'b'
+	case f.FD:
+		kind = 'd'
+	default:
+		kind = 't'
+	}
+	id := canframe.FormatID(f.ID, f.Extended)
+	if f.Extended {
+		kind -= 'a' - 'A'
+	}
+	if (!f.Extended && f.ID > canframe.MaxStandardID) || f.ID > canframe.MaxExtendedID {
+		return nil, fmt.Errorf("slcan: CAN ID %s out of range", id)
+	}
+
+	line := make([]byte, 0, 2+len(id)+2*length)
+	line = append(line, kind)
+	line = append(line, id...)
+	line = append(line, "0123456789ABCDEF"[canframe.LengthToDLC(length)])
+	if !f.RTR {
+		line = fmt.Appendf(line, "%X", f.Data[:length])
+	}
+	return line, nil
+}
+
+// adapterClock turns the adapter's wrapping millisecond counter into system
+// time. It is anchored to the host time of the first frame and re-anchored
+// when the two drift apart by more than a second, e.g. after the bus was
+// quiet for longer than a wrap.
+type adapterClock struct {
+	anchored bool
+	base     time.Time
+	last     uint16
+	elapsed  time.Duration
+}
+
+const adapterWrap = 60000 // milliseconds
+
+func (c *adapterClock) at(ms uint16, now time.Time) time.Time {
+	if !c.anchored || ms >= adapterWrap {
+		c.anchored, c.base, c.last, c.elapsed = true, now, ms%adapterWrap, 0
+		return now
+	}
+	delta := (int(ms) - int(c.last) + adapterWrap) % adapterWrap
+	c.last = ms
+	c.elapsed += time.Duration(delta) * time.Millisecond
+	t := c.base.Add(c.elapsed)
+	if drift := now.Sub(t); drift > time.Second || drift < -time.Second {
+		c.base, c.elapsed = now, 0
+		return now
+	}
+	return t
+}
@@ -0,0 +1,175 @@
+//go:build linux
+
+package slcan
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/cansock"
+	"golang.org/x/sys/unix"
+)
+
+// openPTY opens a pseudo-terminal and returns its master side and the path of
+// the slave, which Open treats like an adapter's serial device.
+func openPTY(t *testing.T) (*os.File, string) {
+	t.Helper()
+	// Non-blocking, so Close interrupts a pending Read
+	fd, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminals: %v", err)
+	}
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		unix.Close(fd)
+		t.Fatalf("unlocking pty: %v", err)
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		unix.Close(fd)
+		t.Fatalf("pty number: %v", err)
+	}
+	master := os.NewFile(uintptr(fd), "ptmx")
+	t.Cleanup(func() { master.Close() })
+	return master, fmt.Sprintf("/dev/pts/%d", n)
+}
+
+// simulateAdapter answers the commands written to the pty like an adapter
+// whose channel is closed: C is rejected with BEL, everything else accepted.
+// Every non-empty command is sent on the returned channel.
+func simulateAdapter(master *os.File) <-chan string {
+	commands := make(chan string, 16)
+	go func() {
+		defer close(commands)
+		var pending []byte
+		buf := make([]byte, 256)
+		for {
+			n, err := master.Read(buf)
+			if err != nil {
+				return
+			}
+			pending = append(pending, buf[:n]...)
+			for {
+				i := bytes.IndexByte(pending, '\r')
+				if i < 0 {
+					break
+				}
+				cmd := string(pending[:i])
+				pending = pending[i+1:]
+				if cmd == "" {
+					continue
+				}
+				commands <- cmd
+				answer := "\r"
+				if cmd == "C" {
+					answer = "\a"
+				}
+				if _, err := master.WriteString(answer); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return commands
+}
+
+func receive(t *testing.T, commands <-chan string, n int) []string {
+	t.Helper()
+	var got []string
+	for len(got) < n {
+		select {
+		case cmd, ok := <-commands:
+			if !ok {
+				t.Fatalf("adapter closed after %q", got)
+			}
+			got = append(got, cmd)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("got commands %q, want %d", got, n)
+		}
+	}
+	return got
+}
+
+func TestOpenSetup(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{"defaults", nil, []string{"C", "S6", "Z1", "O"}},
+		{"listen only", []Option{WithBitrate(250000), WithListenOnly(), WithoutTimestamps()}, []string{"C", "S5", "Z0", "L"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			master, device := openPTY(t)
+			commands := simulateAdapter(master)
+
+			conn, err := Open(device, tt.opts...)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			if got := receive(t, commands, len(tt.want)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("setup commands %q, want %q", got, tt.want)
+			}
+
+			if err := conn.Close(); err != nil {
+				t.Errorf("Close: %v", err)
+			}
+			if got := receive(t, commands, 1); got[0] != "C" {
+				t.Errorf("Close sent %q, want C", got[0])
+			}
+		})
+	}
+}
+
+func TestOpenUnsupportedBitrate(t *testing.T) {
+	if _, err := Open("/dev/null", WithBitrate(333000)); err == nil {
+		t.Error("Open accepted a bitrate without S code")
+	}
+}
+
+func TestReadWriteFrames(t *testing.T) {
+	master, device := openPTY(t)
+	commands := simulateAdapter(master)
+	conn, err := Open(device)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer conn.Close()
+	receive(t, commands, 4)
+
+	// A transmit acknowledgement and a BEL before the frame are skipped; the
+	// first timestamped frame is anchored to the host time, the next one 250 ms later
+	if _, err := master.WriteString("z\r\at1232AABB0100\rT1FFFFFF01FA0196\r"); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	first, err := conn.ReadFrame()
+	if err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	if first.ID != 0x123 || first.Length != 2 || first.Data[1] != 0xBB || first.TimeSource != cansock.TimeAdapter {
+		t.Errorf("first frame %+v", first)
+	}
+	second, err := conn.ReadFrame()
+	if err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	if second.ID != 0x1FFFFFF0 || !second.Extended || second.Data[0] != 0xFA {
+		t.Errorf("second frame %+v", second)
+	}
+	if gap := second.Time.Sub(first.Time); gap != 150*time.Millisecond {
+		t.Errorf("timestamps %v apart, want 150ms", gap)
+	}
+
+	frame := cansock.Frame{ID: 0x6B0, Length: 1, Data: [64]byte{0x42}}
+	if err := conn.WriteFrame(&frame); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	if got := receive(t, commands, 1); got[0] != "t6B0142" {
+		t.Errorf("WriteFrame sent %q, want t6B0142", got[0])
+	}
+}
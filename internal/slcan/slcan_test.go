@@ -0,0 +1,120 @@
+package slcan
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YOUR_USERNAME/WE-EV-CAN-Dashboard/internal/cansock"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		line  string
+		check func(f cansock.Frame) bool
+	}{
+		{"t1232AABB", func(f cansock.Frame) bool {
+			return f.ID == 0x123 && !f.Extended && f.Length == 2 && f.Data[0] == 0xAA && f.Data[1] == 0xBB
+		}},
+		{"t0000", func(f cansock.Frame) bool { return f.ID == 0 && f.Length == 0 }},
+		{"T1FFFFFF080119000708000043", func(f cansock.Frame) bool {
+			return f.ID == 0x1FFFFFF0 && f.Extended && f.Length == 8 && f.Data[7] == 0x43
+		}},
+		{"r7DF8", func(f cansock.Frame) bool { return f.ID == 0x7DF && f.RTR && f.Length == 8 && len(f.Payload()) == 0 }},
+		{"R18FF50E53", func(f cansock.Frame) bool { return f.ID == 0x18FF50E5 && f.Extended && f.RTR && f.Length == 3 }},
+		{"d1239" + strings.Repeat("A5", 12), func(f cansock.Frame) bool {
+			return f.FD && !f.BRS && f.Length == 12 && f.Data[11] == 0xA5
+		}},
+		{"B18FF50E5F" + strings.Repeat("01", 64), func(f cansock.Frame) bool {
+			return f.Extended && f.FD && f.BRS && f.Length == 64 && f.Data[63] == 0x01
+		}},
+	}
+	for _, tt := range tests {
+		frame, _, stamped, err := ParseFrame([]byte(tt.line))
+		if err != nil {
+			t.Errorf("ParseFrame(%q): %v", tt.line, err)
+			continue
+		}
+		if stamped || !tt.check(frame) {
+			t.Errorf("ParseFrame(%q) = %+v, stamped %v", tt.line, frame, stamped)
+		}
+		line, err := FormatFrame(&frame)
+		if err != nil || string(line) != tt.line {
+			t.Errorf("FormatFrame(ParseFrame(%q)) = %q, %v", tt.line, line, err)
+		}
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	frame, ms, stamped, err := ParseFrame([]byte("t6B12aabbEA5F"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stamped || ms != 0xEA5F || frame.ID != 0x6B1 || frame.Data[0] != 0xAA {
+		t.Errorf("ParseFrame = %+v, ms %d, stamped %v", frame, ms, stamped)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"x1232AABB",
+		"t12",
+		"t8001AA",       // standard ID out of range
+		"T200000001AA",  // extended ID out of range
+		"t1239AABB",     // classic DLC above 8
+		"t12G1AA",       // bad ID
+		"t1232AA",       // data shorter than the length
+		"t1232AAZZ",     // bad data
+		"t1232AABB12",   // trailing characters
+		"t1232AABB12G4", // bad timestamp
+		"d1239AABBCCDD", // FD data shorter than 12 bytes
+	} {
+		if frame, _, _, err := ParseFrame([]byte(line)); err == nil {
+			t.Errorf("ParseFrame(%q) = %+v, want an error", line, frame)
+		}
+	}
+}
+
+func TestFormatInvalid(t *testing.T) {
+	for name, frame := range map[string]cansock.Frame{
+		"error frame":     {ID: 4, Error: true, Length: 8},
+		"standard ID":     {ID: 0x800, Length: 1},
+		"extended ID":     {ID: 0x20000000, Extended: true},
+		"classic length":  {ID: 0x123, Length: 9},
+		"FD length":       {ID: 0x123, FD: true, Length: 13},
+		"remote FD frame": {ID: 0x123, FD: true, RTR: true, Length: 8},
+	} {
+		if line, err := FormatFrame(&frame); err == nil {
+			t.Errorf("%s: FormatFrame = %q, want an error", name, line)
+		}
+	}
+}
+
+func TestAdapterClock(t *testing.T) {
+	var c adapterClock
+	start := time.Date(2025, 11, 22, 16, 17, 0, 0, time.UTC)
+
+	if got := c.at(59990, start); !got.Equal(start) {
+		t.Fatalf("first frame at %v, want the host time %v", got, start)
+	}
+	// The counter wraps from 59999 to 0: 59990 -> 10 is 20 ms
+	if got, want := c.at(10, start.Add(25*time.Millisecond)), start.Add(20*time.Millisecond); !got.Equal(want) {
+		t.Errorf("after the wrap at %v, want %v", got, want)
+	}
+	if got, want := c.at(500, start.Add(505*time.Millisecond)), start.Add(510*time.Millisecond); !got.Equal(want) {
+		t.Errorf("at %v, want %v", got, want)
+	}
+	// A quiet bus longer than a wrap hides whole periods; the clock re-anchors
+	later := start.Add(2 * time.Minute)
+	if got := c.at(600, later); !got.Equal(later) {
+		t.Errorf("after 2 minutes at %v, want the host time %v", got, later)
+	}
+	if got, want := c.at(700, later.Add(100*time.Millisecond)), later.Add(100*time.Millisecond); !got.Equal(want) {
+		t.Errorf("after re-anchoring at %v, want %v", got, want)
+	}
+	// Values outside the counter range also re-anchor
+	if got := c.at(60000, later.Add(time.Second)); !got.Equal(later.Add(time.Second)) {
+		t.Errorf("out of range counter at %v, want the host time", got)
+	}
+}